@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+)
+
+// topic alerts are published to, the tx topic plus config.AlertSuffix
+var topicAlert string
+
+// which side of the thresholds the temperature was last seen on
+const (
+	alertNone = iota
+	alertHigh
+	alertLow
+)
+
+var alertState = alertNone
+
+// Compare temp against config.AlertHigh and config.AlertLow and return the
+// alert to raise ("high", "low" or "clear" once back in range), or "" if
+// nothing changed. A raised alert only clears after the reading moves
+// config.AlertHysteresis back inside the range, so a reading hovering at a
+// threshold raises one alert and not one per publish.
+func checkAlert(temp float32) string {
+	switch alertState {
+	case alertNone:
+		if temp >= config.AlertHigh {
+			alertState = alertHigh
+			return "high"
+		}
+		if temp <= config.AlertLow {
+			alertState = alertLow
+			return "low"
+		}
+	case alertHigh:
+		if temp < config.AlertHigh-config.AlertHysteresis {
+			alertState = alertNone
+			return "clear"
+		}
+	case alertLow:
+		if temp > config.AlertLow+config.AlertHysteresis {
+			alertState = alertNone
+			return "clear"
+		}
+	}
+	return ""
+}
+
+// publish alert with the reading that raised it, like
+// {"alert":"high","t":31.5,"tu":"C"}
+func publishAlert(alert string, temp float32) {
+	t, tu := tempIn(temp)
+	payload := `{"alert":"` + alert + `","t":` + strconv.FormatFloat(float64(t), 'f', -1, 32) + `,"tu":"` + tu + `"}`
+	pub.SendWith(topicAlert, []byte(payload), qos, config.EventRetain)
+}
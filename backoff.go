@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff hands out capped, exponentially growing delays between retries.
+// Each delay is jittered down by up to half, so boards that lost the
+// broker at the same moment don't all come back in lockstep.
+type Backoff struct {
+	min, max time.Duration
+	cur      time.Duration
+}
+
+// NewBackoff returns a Backoff starting at min and doubling up to max
+func NewBackoff(min, max time.Duration) *Backoff {
+	return &Backoff{min: min, max: max}
+}
+
+// Next is the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	if b.cur == 0 {
+		b.cur = b.min
+	} else if b.cur < b.max {
+		b.cur *= 2
+		if b.cur > b.max {
+			b.cur = b.max
+		}
+	}
+	half := b.cur / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Reset starts again from min, after a success
+func (b *Backoff) Reset() {
+	b.cur = 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowsToCap(t *testing.T) {
+	b := NewBackoff(time.Second, 10*time.Second)
+	// the undelayed delay of each attempt; next returns between half of
+	// it and all of it
+	tests := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second, // capped
+		10 * time.Second,
+		10 * time.Second,
+	}
+	for i, want := range tests {
+		d := b.Next()
+		if d < want/2 || d > want {
+			t.Errorf("attempt %d: next() = %v, want %v to %v", i+1, d, want/2, want)
+		}
+		if b.cur != want {
+			t.Errorf("attempt %d: cur = %v, want %v", i+1, b.cur, want)
+		}
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+	b := NewBackoff(100*time.Millisecond, time.Second)
+	for i := 0; i < 5; i++ {
+		b.Next()
+	}
+	b.Reset()
+	if d := b.Next(); d > 100*time.Millisecond {
+		t.Errorf("next() after reset = %v, want at most 100ms", d)
+	}
+}
+
+func TestBackoffMinAboveMax(t *testing.T) {
+	// a min at or over max never grows
+	b := NewBackoff(4*time.Second, 2*time.Second)
+	for i := 0; i < 3; i++ {
+		if d := b.Next(); d > 4*time.Second {
+			t.Errorf("attempt %d: next() = %v, want at most 4s", i+1, d)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+)
+
+// ADC reference voltage of the SAMD21 on the Nano 33 IoT
+const adcRef = 3.3
+
+// ADC on config.BatteryPin, set up by setupBattery
+var batteryADC machine.ADC
+
+// whether the low battery warning has been shown since the voltage was
+// last above config.BatteryLow
+var batteryWarned bool
+
+// set up the ADC on config.BatteryPin, if there is one
+func setupBattery() {
+	if config.BatteryPin == machine.NoPin {
+		return
+	}
+	machine.InitADC()
+	batteryADC = machine.ADC{Pin: config.BatteryPin}
+	batteryADC.Configure(machine.ADCConfig{})
+}
+
+// battery voltage behind the divider on config.BatteryPin, 0 without one.
+// Averages a few samples since single readings are noisy.
+func readBattery() float32 {
+	if config.BatteryPin == machine.NoPin {
+		return 0
+	}
+	var sum uint32
+	for i := 0; i < 8; i++ {
+		sum += uint32(batteryADC.Get())
+	}
+	return adcToVolts(uint16(sum/8), adcRef, config.BatteryDivider)
+}
+
+// Convert a raw reading to the voltage before a divider of ratio
+// (V in / V out). TinyGo scales every ADC to 16 bits whatever its
+// resolution, so full scale is 0xFFFF.
+func adcToVolts(raw uint16, ref, ratio float32) float32 {
+	return float32(raw) / 0xFFFF * ref * ratio
+}
+
+// report whether v just dropped below config.BatteryLow, only once until
+// it recovers
+func batteryLow(v float32) bool {
+	if v <= 0 || v >= config.BatteryLow {
+		batteryWarned = false
+		return false
+	}
+	if batteryWarned {
+		return false
+	}
+	batteryWarned = true
+	return true
+}
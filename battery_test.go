@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"math"
+	"testing"
+)
+
+func TestAdcToVolts(t *testing.T) {
+	tests := []struct {
+		raw        uint16
+		ref, ratio float32
+		want       float32
+	}{
+		{0, 3.3, 2, 0},
+		{0xFFFF, 3.3, 1, 3.3},
+		{0xFFFF, 3.3, 2, 6.6},
+		{0x8000, 3.3, 2, 3.3},   // half scale
+		{0x4000, 3.3, 1, 0.825}, // quarter scale
+		{0xFFFF, 3.3, 0, 0},     // no divider set
+	}
+	for _, tt := range tests {
+		got := adcToVolts(tt.raw, tt.ref, tt.ratio)
+		if math.Abs(float64(got-tt.want)) > 0.001 {
+			t.Errorf("adcToVolts(%#04x, %v, %v) = %v, want %v", tt.raw, tt.ref, tt.ratio, got, tt.want)
+		}
+	}
+}
+
+func TestBatteryLowWarnsOnce(t *testing.T) {
+	defer func(low float32) { config.BatteryLow = low }(config.BatteryLow)
+	config.BatteryLow = 3.5
+	batteryWarned = false
+
+	tests := []struct {
+		v    float32
+		want bool
+	}{
+		{0, false}, // no battery
+		{4.0, false},
+		{3.4, true},  // just dropped
+		{3.3, false}, // already warned
+		{3.2, false},
+		{3.6, false}, // recovered
+		{3.4, true},  // dropped again
+	}
+	for i, tt := range tests {
+		if got := batteryLow(tt.v); got != tt.want {
+			t.Errorf("step %d: batteryLow(%v) = %t, want %t", i+1, tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"time"
+)
+
+// when the active broker last changed
+var brokerSwitched time.Time
+
+// report whether the station is on config.SecondaryBroker
+func onSecondary() bool {
+	return config.SecondaryBroker != "" && server == config.SecondaryBroker
+}
+
+// Make url the broker the next Connect dials, showing which one is now
+// active. The tinygo client reads the URL from its options at every
+// Connect, so changing them is enough; the subscriptions are made again
+// by connectMQTT.
+func useBroker(url string, display func(msg string)) {
+	if url == server {
+		return
+	}
+	server = url
+	brokerSwitched = time.Now()
+	if mqttOpts != nil {
+		mqttOpts.AddBroker(url)
+	}
+	logInfo("broker now " + url)
+	if onSecondary() {
+		display("broker: secondary")
+	} else {
+		display("broker: primary")
+	}
+}
+
+// the broker to try next, given how long reconnecting has failed: the
+// other one once config.FailoverTimeout has passed on this one
+func failover(failingFor time.Duration) string {
+	if config.SecondaryBroker == "" || failingFor < config.FailoverTimeout {
+		return server
+	}
+	if onSecondary() {
+		return config.Broker
+	}
+	return config.SecondaryBroker
+}
+
+// report whether it is time to leave the secondary broker for another go
+// at the primary, which needs dropping the connection as the NINA has only
+// one socket
+func failbackDue() bool {
+	return onSecondary() && config.FailbackInterval > 0 && time.Since(brokerSwitched) >= config.FailbackInterval
+}
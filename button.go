@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"runtime/volatile"
+	"time"
+)
+
+// how long the button must stay pressed to count
+const debounce = 50 * time.Millisecond
+
+// Button is a push-button wired from Pin to ground that calls OnPress once
+// per debounced press.
+type Button struct {
+	Pin     machine.Pin
+	OnPress func()
+
+	// set from the pin interrupt, cleared by watch
+	pressed volatile.Register8
+}
+
+// Wait for presses forever. The interrupt only records the edge;
+// debouncing and OnPress happen here since neither sleeping nor I2C is
+// safe inside an interrupt handler.
+func (b *Button) watch() {
+	b.Pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	err := b.Pin.SetInterrupt(machine.PinFalling, func(machine.Pin) {
+		b.pressed.Set(1)
+	})
+	if err != nil {
+		logError("button: " + err.Error())
+		return
+	}
+
+	for {
+		time.Sleep(10 * time.Millisecond)
+		if b.pressed.Get() == 0 {
+			continue
+		}
+		b.pressed.Set(0)
+
+		time.Sleep(debounce)
+		if !b.Pin.Get() {
+			b.OnPress()
+		}
+	}
+}
+
+// signalled by a button to make loop() read and publish without waiting
+// out the interval
+var publishNow = make(chan struct{}, 1)
+
+// ask loop() for a reading now; a request already pending is enough
+func requestPublish() {
+	select {
+	case publishNow <- struct{}{}:
+	default:
+	}
+}
+
+// Start a goroutine for each configured button: shutdown, backlight on/off,
+// next rotation item and publish now.
+func setupButtons(lcd Displayer) {
+	buttons := []*Button{
+		{Pin: config.ShutdownPin, OnPress: requestShutdown},
+		{Pin: config.BacklightPin, OnPress: func() {
+			lcdMu.Lock()
+			if backlightOn {
+				setBacklight(lcd, false)
+			} else {
+				wake(lcd)
+			}
+			lcdMu.Unlock()
+		}},
+		{Pin: config.RotatePin, OnPress: rotation.skip},
+		{Pin: config.PublishPin, OnPress: requestPublish},
+	}
+	for _, b := range buttons {
+		if b.Pin != machine.NoPin {
+			goSafe("button", b.watch)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strings"
+	"unicode/utf8"
+)
+
+// shown for runes the character ROM has no code for
+const romPlaceholder = '?'
+
+// katakana in the order of their A00 codes, starting at 0xA6
+const romKatakana = "ヲァィゥェォャュョッーアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワン"
+
+// A00 codes of the voiced and semi-voiced sound marks
+const (
+	romDakuten    = 0xDE
+	romHandakuten = 0xDF
+)
+
+// runes of the A00 (Japanese) ROM outside ASCII, each one or, for voiced
+// katakana, two display codes. Filled by init.
+var romA00 = map[rune][]byte{
+	'¥': {0x5C},
+	'→': {0x7E},
+	'←': {0x7F},
+	'。': {0xA1},
+	'「': {0xA2},
+	'」': {0xA3},
+	'、': {0xA4},
+	'・': {0xA5},
+	'°': {0xDF},
+	'α': {0xE0},
+	'ä': {0xE1},
+	'β': {0xE2},
+	'ε': {0xE3},
+	'µ': {0xE4},
+	'σ': {0xE5},
+	'ρ': {0xE6},
+	'√': {0xE8},
+	'¢': {0xEC},
+	'ñ': {0xEE},
+	'ö': {0xEF},
+	'θ': {0xF2},
+	'∞': {0xF3},
+	'Ω': {0xF4},
+	'ü': {0xF5},
+	'Σ': {0xF6},
+	'π': {0xF7},
+	'÷': {0xFD},
+	'█': {0xFF},
+}
+
+func init() {
+	code := byte(0xA6)
+	for _, r := range romKatakana {
+		romA00[r] = []byte{code}
+		code++
+	}
+	// ガ is カ plus one in Unicode, パ is ハ plus two
+	for _, r := range "カキクケコサシスセソタチツテトハヒフヘホ" {
+		romA00[r+1] = []byte{romA00[r][0], romDakuten}
+	}
+	for _, r := range "ハヒフヘホ" {
+		romA00[r+2] = []byte{romA00[r][0], romHandakuten}
+	}
+	romA00['ヴ'] = []byte{romA00['ウ'][0], romDakuten}
+}
+
+// an encoder turns a UTF-8 message into the bytes a display shows as its
+// characters
+type encoder func(msg string) string
+
+// encoders for config.Charset
+var encoders = [...]encoder{
+	config.CharsetA00:   encodeA00,
+	config.CharsetA02:   encodeA02,
+	config.CharsetASCII: encodeASCII,
+}
+
+// Translate msg for the display with the encoder config.Charset selects.
+// Plain ASCII is passed through as is by every encoder, except for the
+// two codes A00 replaces.
+func toROM(msg string) string {
+	if config.Charset < 0 || config.Charset >= len(encoders) {
+		return msg
+	}
+	return encoders[config.Charset](msg)
+}
+
+// report whether msg is all ASCII other than the bytes in except
+func plainASCII(msg, except string) bool {
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x80 || strings.IndexByte(except, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// A00 (Japanese) ROM codes. Its ASCII lacks \ and ~, which are ¥ and →
+// there, so both show as the placeholder. Hiragana shows as katakana,
+// which is all it has.
+func encodeA00(msg string) string {
+	if plainASCII(msg, "\\~") {
+		return msg
+	}
+	out := make([]byte, 0, len(msg))
+	for _, r := range msg {
+		switch {
+		case r == utf8.RuneError:
+			out = append(out, romPlaceholder)
+		case r < 0x80 && r != '\\' && r != '~':
+			out = append(out, byte(r))
+		default:
+			if r >= 'ぁ' && r <= 'ゖ' {
+				r += 'ァ' - 'ぁ'
+			}
+			if r >= 0xFF61 && r <= 0xFF9F {
+				// half-width katakana are laid out like the ROM
+				out = append(out, byte(r-0xFF61+0xA1))
+			} else if codes, ok := romA00[r]; ok {
+				out = append(out, codes...)
+			} else {
+				out = append(out, romPlaceholder)
+			}
+		}
+	}
+	return string(out)
+}
+
+// A02 (European) ROM codes, which follow Latin-1 for the upper half, so
+// accented letters and ° come out right
+func encodeA02(msg string) string {
+	if plainASCII(msg, "") {
+		return msg
+	}
+	out := make([]byte, 0, len(msg))
+	for _, r := range msg {
+		switch {
+		case r == utf8.RuneError:
+			out = append(out, romPlaceholder)
+		case r < 0x80, r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		default:
+			out = append(out, romPlaceholder)
+		}
+	}
+	return string(out)
+}
+
+// the bytes as they are, for displays with their own font or messages
+// already in display codes
+func encodeASCII(msg string) string {
+	return msg
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// coalescer draws messages on lcd only once none has come for window, so
+// a burst costs one redraw of its last message instead of one per message
+// and the I2C bus doesn't saturate. clock and sleep are time.Now and
+// time.Sleep outside of tests.
+type coalescer struct {
+	lcd    Displayer
+	window time.Duration
+	clock  func() time.Time
+	sleep  func(time.Duration)
+
+	mu      sync.Mutex
+	pending string
+	last    time.Time // when pending arrived
+	seq     int       // counts show calls, so a stale drawer can tell
+	waiting bool      // a drawer is waiting out the window
+
+	// orders the drawing of one burst before the next
+	drawMu sync.Mutex
+}
+
+// new coalescer for lcd; a window of 0 or less draws every message at once
+func newCoalescer(lcd Displayer, window time.Duration, clock func() time.Time, sleep func(time.Duration)) *coalescer {
+	return &coalescer{lcd: lcd, window: window, clock: clock, sleep: sleep}
+}
+
+// show msg once the burst it belongs to is over, replacing anything still
+// waiting
+func (c *coalescer) show(msg string) {
+	if c.window <= 0 {
+		lcdDisp(c.lcd, msg)
+		return
+	}
+	c.mu.Lock()
+	c.pending = msg
+	c.last = c.clock()
+	c.seq++
+	start := !c.waiting
+	c.waiting = true
+	c.mu.Unlock()
+	if start {
+		goSafe("coalesced draw", c.drawWhenQuiet)
+	}
+}
+
+// wait until nothing new has come for the window, then draw the latest
+func (c *coalescer) drawWhenQuiet() {
+	for {
+		c.mu.Lock()
+		quiet := c.clock().Sub(c.last)
+		if quiet >= c.window {
+			msg, seq := c.pending, c.seq
+			c.waiting = false
+			c.mu.Unlock()
+			c.draw(msg, seq)
+			return
+		}
+		c.mu.Unlock()
+		c.sleep(c.window - quiet)
+	}
+}
+
+// draw msg unless a later burst has been drawn or is waiting, so the last
+// message is always the one left on screen
+func (c *coalescer) draw(msg string, seq int) {
+	c.drawMu.Lock()
+	defer c.drawMu.Unlock()
+	c.mu.Lock()
+	stale := seq != c.seq
+	c.mu.Unlock()
+	if !stale {
+		lcdDisp(c.lcd, msg)
+	}
+}
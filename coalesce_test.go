@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when the test advances it; sleep
+// blocks until it has moved far enough
+type fakeClock struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	now  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until := c.now.Add(d)
+	for c.now.Before(until) {
+		c.cond.Wait()
+	}
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// countingDisplay counts the redraws lcdDisp makes, each starting with a
+// Clear
+type countingDisplay struct {
+	*serialDisplay
+	mu     sync.Mutex
+	clears int
+}
+
+func (d *countingDisplay) Clear() {
+	d.mu.Lock()
+	d.clears++
+	d.mu.Unlock()
+	d.serialDisplay.Clear()
+}
+
+func (d *countingDisplay) redraws() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clears
+}
+
+func TestCoalescerDrawsLastOfBurstOnce(t *testing.T) {
+	clock := newFakeClock()
+	d := &countingDisplay{serialDisplay: newSerialDisplay()}
+	lcdShown = ""
+	c := newCoalescer(d, 100*time.Millisecond, clock.Now, clock.Sleep)
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		c.show(msg)
+		clock.Advance(30 * time.Millisecond)
+	}
+	// give the drawer a chance to (wrongly) draw before the window is over
+	time.Sleep(50 * time.Millisecond)
+	if n := d.redraws(); n != 0 {
+		t.Fatalf("%d redraws during the burst, want 0", n)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	for deadline := time.Now().Add(time.Second); d.redraws() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := d.redraws(); n != 1 {
+		t.Errorf("%d redraws after the burst, want 1", n)
+	}
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	if got := rowText(d.serialDisplay, 0); got[:4] != "four" {
+		t.Errorf("row 0 = %q, want the last message", got)
+	}
+}
+
+func TestCoalescerNoWindowDrawsAtOnce(t *testing.T) {
+	d := &countingDisplay{serialDisplay: newSerialDisplay()}
+	lcdShown = ""
+	c := newCoalescer(d, 0, time.Now, time.Sleep)
+	c.show("a")
+	c.show("b")
+	if n := d.redraws(); n != 2 {
+		t.Errorf("%d redraws, want 2", n)
+	}
+}
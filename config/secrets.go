@@ -0,0 +1,28 @@
+package config
+
+// Secrets set at build time with
+//
+//	-ldflags "-X github.com/amanoese/belltomo/config.buildSSID=..."
+//
+// (see the Makefile), so they need not be written into config.go where
+// they are easily committed. Empty ones leave the config.go values alone.
+var (
+	buildSSID         string
+	buildPASS         string
+	buildMQTTUser     string
+	buildMQTTPassword string
+)
+
+func init() {
+	override(&SSID, buildSSID)
+	override(&PASS, buildPASS)
+	override(&MQTTUser, buildMQTTUser)
+	override(&MQTTPassword, buildMQTTPassword)
+}
+
+// set *v to s unless s is empty
+func override(v *string, s string) {
+	if s != "" {
+		*v = s
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+// AccessPoint is a WiFi network the device may join.
+type AccessPoint struct {
+	SSID string
+	PASS string
+}
+
+// Levels for LogLevel, most verbose first.
+const (
+	LogDebug = iota
+	LogInfo
+	LogError
+)
+
+// Sensors for Sensor.
+const (
+	SensorDHT22 = iota
+	SensorBME280
+	SensorUART // CRC-checked frames from another board on UART1
+)
+
+// Display encodings for Charset.
+const (
+	CharsetA00   = iota // HD44780 A00 ROM: Japanese, with katakana
+	CharsetA02          // HD44780 A02 ROM: European, mostly Latin-1
+	CharsetASCII        // bytes passed through unchanged
+)
+
+// Displays for DisplayType.
+const (
+	DisplayHD44780 = iota // character LCD with a PCF8574 backpack
+	DisplaySSD1306        // 128x64 or 128x32 I2C OLED
+)
+
+// Units for TempUnit and PressureUnit.
+const (
+	Celsius = iota
+	Fahrenheit
+)
+
+const (
+	HPa = iota
+	InHg
+)
+
+// Buses for I2CBus.
+const (
+	I2CBus0 = iota // machine.I2C0, on the SDA and SCL pins
+	I2CBus1        // machine.I2C1
+)
+
+// Serial consoles for Console.
+const (
+	ConsoleUSB  = iota // the USB port
+	ConsoleUART        // UART1 on the D0 (RX) and D1 (TX) pins
+)
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the settings that would otherwise only fail halfway
+// through boot, returning the first problem found. Messages are short so
+// they fit on the LCD.
+func Validate() error {
+	// nothing is joined in simulation mode
+	if !Simulate && SSID == "" {
+		return errors.New("SSID is empty")
+	}
+	if !Simulate && PASS == "" {
+		return errors.New("PASS is empty")
+	}
+	for _, ap := range FallbackAPs {
+		if ap.SSID == "" {
+			return errors.New("FallbackAPs SSID is empty")
+		}
+	}
+	if err := validateBroker("Broker", Broker); err != nil {
+		return err
+	}
+	if SecondaryBroker != "" {
+		if err := validateBroker("SecondaryBroker", SecondaryBroker); err != nil {
+			return err
+		}
+	}
+	if MQTTPassword != "" && MQTTUser == "" {
+		// MQTT 3.1.1 only sends a password along with a user name
+		return errors.New("MQTTPassword needs MQTTUser")
+	}
+	if QoS > 2 {
+		return errors.New("QoS must be 0, 1 or 2")
+	}
+	if Sensor == SensorUART && Console == ConsoleUART {
+		return errors.New("UART sensor needs Console USB")
+	}
+	if len(RxTopics) == 0 {
+		return errors.New("RxTopics is empty")
+	}
+	return nil
+}
+
+// check url looks like tcp://host:port or ssl://host:port, naming the
+// setting in the error
+func validateBroker(name, url string) error {
+	var hostPort string
+	switch {
+	case strings.HasPrefix(url, "tcp://"):
+		hostPort = strings.TrimPrefix(url, "tcp://")
+	case strings.HasPrefix(url, "ssl://"):
+		hostPort = strings.TrimPrefix(url, "ssl://")
+	default:
+		return errors.New(name + " must start with tcp:// or ssl://")
+	}
+	i := strings.LastIndexByte(hostPort, ':')
+	if i <= 0 {
+		return errors.New(name + " has no host:port")
+	}
+	if port, err := strconv.Atoi(hostPort[i+1:]); err != nil || port < 1 || port > 65535 {
+		return errors.New(name + " port is bad")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	// a config that passes, changed one setting at a time below
+	valid := func() {
+		Simulate = false
+		SSID, PASS = "home", "secret"
+		FallbackAPs = nil
+		Broker = "tcp://broker.local:1883"
+		SecondaryBroker = ""
+		MQTTUser, MQTTPassword = "", ""
+		QoS = 0
+		Sensor, Console = SensorDHT22, ConsoleUSB
+		RxTopics = []string{"rx"}
+	}
+	defer valid()
+
+	tests := []struct {
+		name   string
+		change func()
+		want   string
+	}{
+		{"valid", func() {}, ""},
+		{"ssl broker", func() { Broker = "ssl://broker.local:8883" }, ""},
+		{"no SSID", func() { SSID = "" }, "SSID is empty"},
+		{"no SSID simulated", func() { SSID, Simulate = "", true }, ""},
+		{"no PASS", func() { PASS = "" }, "PASS is empty"},
+		{"fallback without SSID", func() { FallbackAPs = []AccessPoint{{PASS: "x"}} }, "FallbackAPs SSID is empty"},
+		{"broker scheme", func() { Broker = "mqtt://broker.local:1883" }, "Broker must start with tcp:// or ssl://"},
+		{"broker no port", func() { Broker = "tcp://broker.local" }, "Broker has no host:port"},
+		{"broker no host", func() { Broker = "tcp://:1883" }, "Broker has no host:port"},
+		{"broker port zero", func() { Broker = "tcp://broker.local:0" }, "Broker port is bad"},
+		{"broker port too big", func() { Broker = "tcp://broker.local:65536" }, "Broker port is bad"},
+		{"broker port not a number", func() { Broker = "tcp://broker.local:mqtt" }, "Broker port is bad"},
+		{"secondary broker", func() { SecondaryBroker = "ssl://backup.local:8883" }, ""},
+		{"secondary broker scheme", func() { SecondaryBroker = "backup.local:1883" }, "SecondaryBroker must start with tcp:// or ssl://"},
+		{"secondary broker no port", func() { SecondaryBroker = "tcp://backup.local" }, "SecondaryBroker has no host:port"},
+		{"secondary broker port", func() { SecondaryBroker = "tcp://backup.local:99999" }, "SecondaryBroker port is bad"},
+		{"password without user", func() { MQTTPassword = "x" }, "MQTTPassword needs MQTTUser"},
+		{"user and password", func() { MQTTUser, MQTTPassword = "u", "x" }, ""},
+		{"QoS", func() { QoS = 3 }, "QoS must be 0, 1 or 2"},
+		{"UART twice", func() { Sensor, Console = SensorUART, ConsoleUART }, "UART sensor needs Console USB"},
+		{"no RxTopics", func() { RxTopics = nil }, "RxTopics is empty"},
+	}
+	for _, tt := range tests {
+		valid()
+		tt.change()
+		got := ""
+		if err := Validate(); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: Validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
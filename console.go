@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"strconv"
+)
+
+// UART the log goes to, nil for the USB serial port print writes to
+var consoleUART *machine.UART
+
+// Set up the serial console chosen by config.Console. USB CDC runs at
+// whatever rate the host asks for, so config.Baud only applies to the
+// UART on D0/D1.
+func setupConsole() {
+	if config.Console != config.ConsoleUART {
+		return
+	}
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: config.Baud})
+	consoleUART = machine.UART1
+}
+
+// write s to the console byte by byte, so nothing is allocated
+func consoleWrite(s string) {
+	if consoleUART == nil {
+		print(s)
+		return
+	}
+	for i := 0; i < len(s); i++ {
+		consoleUART.WriteByte(s[i])
+	}
+}
+
+// write n in decimal to the console
+func consoleWriteInt(n int64) {
+	if consoleUART == nil {
+		print(n)
+		return
+	}
+	var buf [20]byte
+	consoleUART.Write(strconv.AppendInt(buf[:0], n, 10))
+}
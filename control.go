@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// topic for device commands like reboot, never shown on the LCD. Set by
+// setupTopics from config.ControlTopic.
+var topicControl string
+
+var (
+	// set by the reboot command so main resets once it has disconnected
+	rebootRequested bool
+
+	shutdownOnce sync.Once
+
+	// probes that came back on topicControl, for checkSubscribed
+	probeSeen = make(chan string, 1)
+
+	// 1 between poll:off and poll:on. Set from the MQTT client's goroutine
+	// and read by loop(), hence atomic.
+	pollPaused uint32
+)
+
+// report whether poll:off has stopped sensor reads and publishes
+func pollingPaused() bool {
+	return atomic.LoadUint32(&pollPaused) != 0
+}
+
+// how long checkSubscribed waits for its probe
+const probeTimeout = 5 * time.Second
+
+// close shutdown so loop() returns, however many times it is asked for
+func requestShutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdown)
+	})
+}
+
+// Run a command sent to topicControl: reboot, which goes through the
+// regular shutdown so the offline status still gets out, poll:off and
+// poll:on to pause and resume the sensor readings (heartbeats and commands
+// carry on), test for lcdTest, or a JSON object for controlJSON.
+func controlCommand(lcd Displayer, payload []byte) {
+	cmd := strings.TrimSpace(string(payload))
+	switch {
+	case cmd == "reboot":
+		logInfo("reboot requested")
+		rebootRequested = true
+		requestShutdown()
+	case cmd == "poll:off":
+		logInfo("polling paused")
+		atomic.StoreUint32(&pollPaused, 1)
+	case cmd == "poll:on":
+		logInfo("polling resumed")
+		atomic.StoreUint32(&pollPaused, 0)
+	case strings.HasPrefix(cmd, "probe:"):
+		select {
+		case probeSeen <- cmd:
+		default:
+		}
+	case cmd == "test":
+		lcdTest(lcd)
+	case strings.HasPrefix(cmd, "{"):
+		controlJSON(lcd, cmd)
+	default:
+		logError("unknown command: " + displayText(payload, config.MaxDisplayLen))
+	}
+}
+
+// Set the screen from an object like
+// {"line0":"Hi","line1":"There","backlight":true}. Each lineN goes on row
+// N alone, cut to the width rather than wrapped; rows not given are left
+// blank, and without any row the text on screen stays. Malformed JSON is
+// logged and ignored.
+func controlJSON(lcd Displayer, cmd string) {
+	fields, err := parseJSONObject(cmd)
+	if err != nil {
+		logError("control: " + err.Error())
+		return
+	}
+
+	rows := make([]string, lcdHeight)
+	given := false
+	for row := range rows {
+		if text, ok := fields["line"+strconv.Itoa(row)]; ok {
+			rows[row] = text
+			given = true
+		}
+	}
+	if given {
+		lcdRows(lcd, rows)
+	}
+
+	switch fields["backlight"] {
+	case "true":
+		lcdCommand(lcd, "backlight:on")
+	case "false":
+		lcdCommand(lcd, "backlight:off")
+	}
+}
+
+// The tinygo mqtt client (drivers v0.17.1) throws the broker's SUBACK
+// away, so neither the ack nor the granted QoS can be seen. Publish a
+// probe to topicControl instead and wait for it to come back, which shows
+// the subscriptions are live. Shows "subscribed" or a timeout, reporting
+// whether it showed anything.
+func checkSubscribed(display func(msg string)) bool {
+	if topicControl == "" || config.Simulate {
+		// nothing would echo the probe back
+		return false
+	}
+	if qos > 0 {
+		logInfo("subscribed at QoS " + strconv.Itoa(int(qos)) + ", granted QoS unknown")
+	}
+	probe := "probe:" + randomString(8)
+	if pub.SendWith(topicControl, []byte(probe), qos, false) != sendSent {
+		logError("probe not sent")
+		display("sub probe failed")
+		return true
+	}
+
+	timeout := time.After(probeTimeout)
+	for {
+		select {
+		case got := <-probeSeen:
+			if got != probe {
+				// left over from an earlier check
+				continue
+			}
+			logInfo("subscribed")
+			display("subscribed")
+			return true
+		case <-timeout:
+			logError("subscribe ack timeout on " + topicControl)
+			display("sub ack timeout")
+			return true
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestControlJSONRows(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		rows []string
+	}{
+		{
+			`{"line0":"Hi","line1":"There"}`,
+			[]string{"Hi              ", "There           "},
+		},
+		{
+			// used to wrap into row 1 and push line1 off the screen
+			`{"line0":"this is far too long for one row","line1":"second"}`,
+			[]string{"this is far too ", "second          "},
+		},
+		{
+			`{"line1":"only the bottom"}`,
+			[]string{"                ", "only the bottom "},
+		},
+	}
+	for _, tt := range tests {
+		d := newSerialDisplay()
+		lcdDisp(d, "old text")
+		controlJSON(d, tt.cmd)
+		for row, want := range tt.rows {
+			if got := rowText(d, row); got != want {
+				t.Errorf("%s: row %d = %q, want %q", tt.cmd, row, got, want)
+			}
+		}
+	}
+}
+
+func TestControlJSONWithoutRowsKeepsText(t *testing.T) {
+	d := newSerialDisplay()
+	lcdShown = ""
+	lcdDisp(d, "kept")
+	controlJSON(d, `{"backlight":true}`)
+	if got, want := rowText(d, 0), "kept            "; got != want {
+		t.Errorf("row 0 = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "strings"
+
+// a handler for messages on topics matching filter
+type route struct {
+	filter  string
+	handler func(payload []byte)
+}
+
+var (
+	// routes in the order they were added; the first match wins
+	routes []route
+
+	// handler for messages no route matches
+	defaultRoute func(payload []byte)
+)
+
+// send messages on topics matching filter, which may use the + and #
+// wildcards, to handler
+func onTopic(filter string, handler func(payload []byte)) {
+	routes = append(routes, route{filter: filter, handler: handler})
+}
+
+// handle messages no route matches with handler
+func onOtherTopics(handler func(payload []byte)) {
+	defaultRoute = handler
+}
+
+// pass payload to the first route matching topic, or the default one
+func dispatch(topic string, payload []byte) {
+	for _, r := range routes {
+		if topicMatches(r.filter, topic) {
+			r.handler(payload)
+			return
+		}
+	}
+	if defaultRoute != nil {
+		defaultRoute(payload)
+	}
+}
+
+// report whether topic matches the subscription filter, where + stands
+// for one level and a trailing # for any number of levels
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
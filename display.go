@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"time"
+	"tinygo.org/x/drivers/hd44780i2c"
+)
+
+// Displayer is the character display the LCD code draws on, so other
+// displays can stand in for the HD44780. Coordinates are in characters.
+type Displayer interface {
+	// blank the screen and move the cursor home
+	Clear()
+	// write data at the cursor, moving it along
+	Print(data []byte)
+	SetCursor(x, y int)
+	// define the 5x8 glyph printed as byte slot (0 to 7)
+	CreateGlyph(slot uint8, pattern []byte)
+	Backlight(on bool)
+}
+
+// hd44780Display adapts the hd44780i2c driver to Displayer
+type hd44780Display struct {
+	dev *hd44780i2c.Device
+}
+
+func (d hd44780Display) Clear() {
+	d.dev.ClearDisplay()
+}
+
+func (d hd44780Display) Print(data []byte) {
+	d.dev.Print(data)
+}
+
+func (d hd44780Display) SetCursor(x, y int) {
+	d.dev.SetCursor(uint8(x), uint8(y))
+}
+
+func (d hd44780Display) CreateGlyph(slot uint8, pattern []byte) {
+	d.dev.CreateCharacter(slot, pattern)
+}
+
+func (d hd44780Display) Backlight(on bool) {
+	d.dev.BacklightOn(on)
+}
+
+// serialDisplay is a Displayer that keeps the screen contents in memory
+// and prints each row to serial as it is drawn. It stands in for the LCD in
+// simulation mode and when none is connected.
+type serialDisplay struct {
+	rows [][]byte
+	x, y int
+}
+
+func newSerialDisplay() *serialDisplay {
+	d := &serialDisplay{rows: make([][]byte, lcdHeight)}
+	for i := range d.rows {
+		d.rows[i] = make([]byte, lcdWidth)
+	}
+	d.Clear()
+	return d
+}
+
+func (d *serialDisplay) Clear() {
+	for _, row := range d.rows {
+		for i := range row {
+			row[i] = ' '
+		}
+	}
+	d.x, d.y = 0, 0
+}
+
+func (d *serialDisplay) SetCursor(x, y int) {
+	d.x, d.y = x, y
+}
+
+func (d *serialDisplay) Print(data []byte) {
+	if d.y >= len(d.rows) {
+		return
+	}
+	row := d.rows[d.y]
+	for _, c := range data {
+		if d.x < len(row) {
+			row[d.x] = c
+		}
+		d.x++
+	}
+	logInfo("LCD" + fmt.Sprint(d.y) + " |" + string(row) + "|")
+}
+
+func (d *serialDisplay) CreateGlyph(slot uint8, pattern []byte) {}
+
+func (d *serialDisplay) Backlight(on bool) {
+	logDebug("LCD backlight " + fmt.Sprint(on))
+}
+
+// how often a display that stopped answering is looked for again
+const reprobeInterval = 5 * time.Second
+
+// watchedBus is i2cBus as the display drivers see it. The drivers drop the
+// errors of their writes, so it notes them for guardedDisplay to see.
+type watchedBus struct {
+	failed bool
+}
+
+// the bus the display drivers are given
+var displayBus watchedBus
+
+func (b *watchedBus) Tx(addr uint16, w, r []byte) error {
+	return b.note(i2cBus.Tx(addr, w, r))
+}
+
+func (b *watchedBus) ReadRegister(addr uint8, r uint8, buf []byte) error {
+	return b.note(i2cBus.ReadRegister(addr, r, buf))
+}
+
+func (b *watchedBus) WriteRegister(addr uint8, r uint8, buf []byte) error {
+	return b.note(i2cBus.WriteRegister(addr, r, buf))
+}
+
+func (b *watchedBus) note(err error) error {
+	if err != nil {
+		b.failed = true
+	}
+	return err
+}
+
+// report whether a write failed since the last call
+func (b *watchedBus) takeFailed() bool {
+	failed := b.failed
+	b.failed = false
+	return failed
+}
+
+// guardedDisplay skips drawing while the display at addr stops answering
+// on I2C, so a hung LCD can't hold up the connect sequence. Every Clear
+// checks it still ACKs, restarting the bus once if not; until one does,
+// everything else is dropped.
+//
+// Any other write the bus reports as failed also takes it down. While it
+// is down, Clear and (every reprobeInterval) the other calls look for it
+// again, at addr and, with config.LCDProbe, the other common
+// addresses, as a flaky connector or a swapped module can change which one
+// answers. Once found, the driver is set up afresh, since the display may
+// have lost power, and the custom glyphs and backlight state restored.
+type guardedDisplay struct {
+	Displayer
+	addr   uint8
+	down   bool
+	probed time.Time
+}
+
+func (d *guardedDisplay) Clear() {
+	if !i2cPresent(i2cBus, d.addr) {
+		logError("display not answering, restarting I2C")
+		restartI2C()
+		if !i2cPresent(i2cBus, d.addr) {
+			d.down = true
+			d.reprobe()
+			if d.down {
+				return
+			}
+		}
+	}
+	d.down = false
+	d.Displayer.Clear()
+	d.checkWrite()
+}
+
+// report whether drawing can go ahead, looking for the display again now
+// and then while it is down
+func (d *guardedDisplay) up() bool {
+	if d.down && time.Since(d.probed) >= reprobeInterval {
+		d.reprobe()
+	}
+	return !d.down
+}
+
+// after a write: if the bus reported it failed, take the display down and
+// look for it at once
+func (d *guardedDisplay) checkWrite() {
+	if !displayBus.takeFailed() {
+		return
+	}
+	logError("display write failed")
+	d.down = true
+	d.reprobe()
+}
+
+// look for the display at every address it might answer at and bind the
+// driver to the first that does
+func (d *guardedDisplay) reprobe() {
+	d.probed = time.Now()
+	addrs := []uint8{d.addr}
+	if config.LCDProbe {
+		addrs = append(addrs, displayAddresses()...)
+	}
+	for _, a := range addrs {
+		if !i2cPresent(i2cBus, a) {
+			continue
+		}
+		if a != d.addr {
+			logInfo("display moved from 0x" + strconv.FormatUint(uint64(d.addr), 16) +
+				" to 0x" + strconv.FormatUint(uint64(a), 16))
+		} else {
+			logInfo("display back at 0x" + strconv.FormatUint(uint64(a), 16))
+		}
+		d.addr = a
+		d.Displayer = bindDisplay(a)
+		for slot, pattern := range glyphs {
+			if pattern != nil {
+				d.Displayer.CreateGlyph(uint8(slot), pattern)
+			}
+		}
+		d.Displayer.Backlight(backlightOn)
+		// the screen starts blank, so redraw the next message in full
+		lcdShown = ""
+		d.down = displayBus.takeFailed()
+		return
+	}
+}
+
+// I2C addresses the configured kind of display commonly uses
+func displayAddresses() []uint8 {
+	if config.DisplayType == config.DisplaySSD1306 {
+		return oledAddresses
+	}
+	return lcdAddresses
+}
+
+func (d *guardedDisplay) Print(data []byte) {
+	if d.up() {
+		d.Displayer.Print(data)
+		d.checkWrite()
+	}
+}
+
+func (d *guardedDisplay) SetCursor(x, y int) {
+	if d.up() {
+		d.Displayer.SetCursor(x, y)
+		d.checkWrite()
+	}
+}
+
+func (d *guardedDisplay) CreateGlyph(slot uint8, pattern []byte) {
+	if d.up() {
+		d.Displayer.CreateGlyph(slot, pattern)
+		d.checkWrite()
+	}
+}
+
+func (d *guardedDisplay) Backlight(on bool) {
+	if d.up() {
+		d.Displayer.Backlight(on)
+		d.checkWrite()
+	}
+}
+
+// dim the display, if it can dim
+func (d *guardedDisplay) SetBrightness(level uint8) {
+	if dim, ok := d.Displayer.(dimmer); ok && d.up() {
+		dim.SetBrightness(level)
+		d.checkWrite()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/hex"
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DS18B20 specifics
+const (
+	ds18b20Family = 0x28
+	dsConvertT    = 0x44
+	dsReadScratch = 0xBE
+	dsConversion  = 750 * time.Millisecond // at 12-bit resolution
+	maxProbes     = 8
+)
+
+// a DS18B20 found on the bus with its latest temperature
+type probe struct {
+	rom  [8]byte
+	id   string // ROM ID as hex, the last part of its topic
+	temp float32
+	ok   bool
+}
+
+var (
+	probeBus oneWire
+	probes   []probe
+
+	// when the running conversion started, zero while none is
+	convStarted time.Time
+
+	// probe the LCD shows next
+	probeShown int
+)
+
+// find the DS18B20s on config.OneWirePin
+func setupProbes() {
+	if config.OneWirePin == machine.NoPin {
+		return
+	}
+	probeBus = oneWire{pin: config.OneWirePin}
+	for _, rom := range probeBus.search(maxProbes) {
+		if rom[0] != ds18b20Family {
+			continue
+		}
+		id := strings.ToUpper(hex.EncodeToString(rom[:]))
+		logInfo("DS18B20 " + id)
+		probes = append(probes, probe{rom: rom, id: id})
+	}
+	logInfo("found " + strconv.Itoa(len(probes)) + " DS18B20")
+}
+
+// start a temperature conversion on every probe at once
+func startConversion() {
+	if !probeBus.reset() {
+		logError("no 1-Wire presence")
+		return
+	}
+	probeBus.writeByte(owSkipROM)
+	probeBus.writeByte(dsConvertT)
+	convStarted = time.Now()
+}
+
+// read the temperature (C) p converted, checking the scratchpad CRC
+func (p *probe) read() (float32, bool) {
+	if !probeBus.selectROM(p.rom) {
+		return 0, false
+	}
+	probeBus.writeByte(dsReadScratch)
+	var sp [9]byte
+	for i := range sp {
+		sp[i] = probeBus.readByte()
+	}
+	if crc8Maxim(sp[:8]) != sp[8] {
+		logError("DS18B20 " + p.id + " CRC mismatch")
+		return 0, false
+	}
+	// sixteenths of a degree
+	return float32(int16(uint16(sp[1])<<8|uint16(sp[0]))) / 16, true
+}
+
+// Called once per loop: collect the conversion started last time once it
+// had its 750ms, publish each probe to its topic, show the next one and
+// start another conversion, so the loop never waits on the probes.
+func pollProbes(pub *Publisher, show func(msg string)) {
+	if len(probes) == 0 {
+		return
+	}
+	if convStarted.IsZero() {
+		startConversion()
+		return
+	}
+	if time.Since(convStarted) < dsConversion {
+		return
+	}
+	for i := range probes {
+		p := &probes[i]
+		p.temp, p.ok = p.read()
+		if !p.ok {
+			continue
+		}
+		t, tu := tempIn(p.temp)
+		payload := `{"t":` + strconv.FormatFloat(float64(t), 'f', -1, 32) + `,"tu":"` + tu + `"}`
+		pub.SendString(topicTx+config.ProbeSuffix+"/"+p.id, payload)
+	}
+
+	// one probe per reading, named by the start of its serial number
+	p := probes[probeShown%len(probes)]
+	probeShown++
+	if p.ok {
+		t, tu := tempIn(p.temp)
+		show(p.id[2:6] + " " + strconv.FormatFloat(float64(t), 'f', 1, 32) + tu)
+	}
+	startConversion()
+}
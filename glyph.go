@@ -0,0 +1,83 @@
+package main
+
+import "strconv"
+
+// CGRAM slots of the custom characters. The HD44780 has only 8, and
+// printing the slot number shows the glyph.
+const (
+	glyphUnkoLeft uint8 = iota
+	glyphUnkoRight
+
+	// bar cells with 1 to 4 of their 5 pixel columns filled from the left;
+	// a full cell is the ROM's solid block
+	glyphBar1
+	glyphBar2
+	glyphBar3
+	glyphBar4
+)
+
+// ROM code of the solid 5x8 block
+const glyphFullBlock = 0xFF
+
+// patterns uploaded by loadGlyphs, indexed by slot; nil slots are unused
+var glyphs [8][]byte
+
+func init() {
+	registerGlyph(glyphUnkoLeft, []byte{0x01, 0x03, 0x04, 0x07, 0x08, 0x0F, 0x10, 0x1F})
+	registerGlyph(glyphUnkoRight, []byte{0x10, 0x18, 0x04, 0x1C, 0x02, 0x1E, 0x01, 0x1F})
+	for i, col := range []byte{0x10, 0x18, 0x1C, 0x1E} {
+		registerGlyph(glyphBar1+uint8(i), []byte{col, col, col, col, col, col, col, col})
+	}
+}
+
+// set the 5x8 pattern (one byte per row) of slot, to be uploaded by
+// loadGlyphs
+func registerGlyph(slot uint8, pattern []byte) {
+	if int(slot) >= len(glyphs) || len(pattern) != 8 {
+		logError("bad glyph for slot " + strconv.Itoa(int(slot)))
+		return
+	}
+	glyphs[slot] = pattern
+}
+
+// upload every registered glyph to CGRAM. Called once at startup, since it
+// survives ClearDisplay and does not need re-sending per message.
+func loadGlyphs(lcd Displayer) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	for slot, pattern := range glyphs {
+		if pattern != nil {
+			lcd.CreateGlyph(uint8(slot), pattern)
+		}
+	}
+}
+
+// print the glyph in slot at the cursor. lcdMu must be held.
+func renderGlyph(lcd Displayer, slot uint8) {
+	lcd.Print([]byte{slot})
+}
+
+// draw frac (0 to 1) of row as a horizontal bar with one pixel column of
+// resolution, blanking the rest of the row. lcdMu must be held.
+func renderBar(lcd Displayer, row int, frac float32) {
+	if frac < 0 {
+		frac = 0
+	} else if frac > 1 {
+		frac = 1
+	}
+	cols := int(frac*float32(lcdWidth*5) + 0.5)
+
+	cells := make([]byte, lcdWidth)
+	for i := range cells {
+		switch n := cols - i*5; {
+		case n >= 5:
+			cells[i] = glyphFullBlock
+		case n > 0:
+			cells[i] = glyphBar1 + uint8(n-1)
+		default:
+			cells[i] = ' '
+		}
+	}
+	lcd.SetCursor(0, row)
+	lcd.Print(cells)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// topic heartbeats go to, the tx topic plus config.UptimeSuffix
+var topicUptime string
+
+// a snapshot of the heap, as publishHeartbeat reports it
+type heapStats struct {
+	free    uint64 // bytes not in use
+	minFree uint64 // lowest free seen since boot
+	size    uint64 // bytes the heap spans
+	objects uint64 // allocations not yet freed
+}
+
+var (
+	// reused so sampling doesn't allocate
+	memStats runtime.MemStats
+
+	// lowest free heap seen by readHeap
+	minFreeHeap uint64 = math.MaxUint64
+)
+
+// Sample the heap. TinyGo has no cheap way to see fragmentation, so free
+// is an upper bound on the largest allocation that can succeed; free
+// going down and objects going up from day to day means a leak. Reading
+// the stats stops the world in TinyGo, so it is only done when needed.
+func readHeap() heapStats {
+	runtime.ReadMemStats(&memStats)
+	free := memStats.HeapSys - memStats.HeapInuse
+	if free < minFreeHeap {
+		minFreeHeap = free
+	}
+	return heapStats{
+		free:    free,
+		minFree: minFreeHeap,
+		size:    memStats.HeapSys,
+		objects: memStats.Mallocs - memStats.Frees,
+	}
+}
+
+// report whether free heap is under config.LowHeap
+func heapLow(h heapStats) bool {
+	return h.free < config.LowHeap
+}
+
+// publish milliseconds since boot and the heap like
+// {"up":123456,"free":10240,"minfree":9800,"heap":32768,"objects":412}
+// and report the heap
+func publishHeartbeat() heapStats {
+	h := readHeap()
+	payload := `{"up":` + strconv.FormatInt(time.Since(bootTime).Milliseconds(), 10) +
+		`,"free":` + strconv.FormatUint(h.free, 10) +
+		`,"minfree":` + strconv.FormatUint(h.minFree, 10) +
+		`,"heap":` + strconv.FormatUint(h.size, 10) +
+		`,"objects":` + strconv.FormatUint(h.objects, 10) + `}`
+	pub.SendWith(topicUptime, []byte(payload), 0, config.EventRetain)
+	return h
+}
+
+// whether a heartbeat is due, given when the last one went out
+func heartbeatDue(last time.Time) bool {
+	return config.HeartbeatInterval > 0 && time.Since(last) >= config.HeartbeatInterval
+}
@@ -0,0 +1,33 @@
+package main
+
+const hexDigits = "0123456789abcdef"
+
+// payload as space-separated hex bytes, at most max of them (0 for no
+// limit) with "..." when there were more
+func hexDump(payload []byte, max int) string {
+	n := len(payload)
+	if max > 0 && n > max {
+		n = max
+	}
+	buf := make([]byte, 0, 3*n+3)
+	for i, b := range payload[:n] {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, hexDigits[b>>4], hexDigits[b&0x0f])
+	}
+	if n < len(payload) {
+		buf = append(buf, "..."...)
+	}
+	return string(buf)
+}
+
+// report whether topic is one of config.BinaryRxTopics
+func isBinaryTopic(topic string) bool {
+	for _, t := range topicsBinary {
+		if topicMatches(t, topic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"strconv"
+	"time"
+)
+
+var (
+	// bus the LCD and the BME280 sit on, set by setupI2C
+	i2cBus *machine.I2C
+
+	// clock rate from config.I2CFrequency, once checked by setupI2C
+	i2cFrequency uint32
+)
+
+// Pick the bus from config.I2CBus and configure it at config.I2CFrequency.
+// Anything but standard (100kHz) or fast (400kHz) mode falls back to
+// 100kHz, which also works on long wiring.
+func setupI2C() {
+	i2cBus = machine.I2C0
+	if config.I2CBus == config.I2CBus1 {
+		i2cBus = machine.I2C1
+	}
+
+	i2cFrequency = config.I2CFrequency
+	switch i2cFrequency {
+	case machine.TWI_FREQ_100KHZ, machine.TWI_FREQ_400KHZ:
+	default:
+		logError("I2C frequency " + strconv.FormatUint(uint64(i2cFrequency), 10) + " not supported, using 100kHz")
+		i2cFrequency = machine.TWI_FREQ_100KHZ
+	}
+	restartI2C()
+}
+
+// free the bus if a device is hanging on to it, then (re)configure it
+func restartI2C() {
+	recoverI2C()
+	i2cBus.Configure(machine.I2CConfig{
+		Frequency: i2cFrequency,
+	})
+}
+
+// Free a device holding SDA low, as a PCF8574 does when the board resets
+// in the middle of a transfer: clock SCL until it lets go (at most 9
+// clocks, a byte and its ACK), then send a STOP. Only the pins of I2C0
+// are known, so I2CBus1 is left alone.
+func recoverI2C() {
+	if config.I2CBus != config.I2CBus0 {
+		return
+	}
+	sda, scl := machine.SDA_PIN, machine.SCL_PIN
+	sda.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	if sda.Get() {
+		return
+	}
+	logError("I2C SDA stuck low, recovering the bus")
+
+	const half = 5 * time.Microsecond // 100kHz
+	scl.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	for i := 0; i < 9 && !sda.Get(); i++ {
+		scl.Low()
+		time.Sleep(half)
+		scl.High()
+		time.Sleep(half)
+	}
+
+	// STOP: SDA rises while SCL is high
+	sda.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	scl.Low()
+	sda.Low()
+	time.Sleep(half)
+	scl.High()
+	time.Sleep(half)
+	sda.High()
+	time.Sleep(half)
+
+	sda.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	if !sda.Get() {
+		logError("I2C bus still stuck")
+		return
+	}
+	logInfo("I2C bus recovered")
+}
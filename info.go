@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"time"
+)
+
+// firmware version reported on the info topic
+const Version = "0.1.0"
+
+// date the firmware was built, set by the Makefile with
+// -ldflags "-X main.buildDate=..."
+var buildDate = "unknown"
+
+// retained topic describing the firmware running on this node, the tx
+// topic plus config.InfoSuffix
+var topicInfo string
+
+// how long from boot the first reading took to go out, 0 until it has.
+// The number that matters most for the battery budget, as the board spends
+// it all awake.
+var firstPublish time.Duration
+
+// note the first reading to go out since boot
+func notePublished() {
+	if firstPublish == 0 {
+		firstPublish = time.Since(bootTime)
+		logInfo("first publish after " + firstPublish.String())
+	}
+}
+
+// Publish the firmware version, build date and MAC address as retained
+// JSON like {"v":"0.1.0","built":"2021-06-01","mac":"..."}, plus the boot
+// time as "boot" once NTP has synced and the milliseconds from boot to the
+// first reading going out as "ttfp" once it has. Kept well under the NINA
+// socket buffer, which is why the keys are so short.
+func publishInfo() {
+	mac := ""
+	if config.Simulate {
+		mac = "sim"
+	} else if m, err := adaptor.GetMACAddress(); err == nil {
+		mac = m.String()
+	}
+	payload := `{"v":"` + Version + `","built":"` + buildDate + `","mac":"` + mac + `"`
+	if clockSynced {
+		payload += `,"boot":"` + bootEpoch.UTC().Format(time.RFC3339) + `"`
+	}
+	if firstPublish > 0 {
+		payload += `,"ttfp":` + strconv.FormatInt(firstPublish.Milliseconds(), 10)
+	}
+	payload += `}`
+	pub.SendWith(topicInfo, []byte(payload), 0, true)
+}
+
+// topic the MAC and IP go to when the IP changes, the tx topic plus
+// config.NetSuffix
+var topicNet string
+
+// IP address last published to topicNet, kept by the WiFi poll in loop()
+var lastIP string
+
+// Publish the MAC and IP like {"mac":"...","ip":"192.168.1.50"} if the
+// IP differs from the one last published, so DHCP lease changes show up
+// across a fleet without a message every poll.
+func publishNetIfChanged() {
+	ip, _, _, err := adaptor.GetIP()
+	if err != nil {
+		logError("GetIP: " + err.Error())
+		return
+	}
+	if ip.String() == lastIP {
+		return
+	}
+	mac := ""
+	if m, err := adaptor.GetMACAddress(); err == nil {
+		mac = m.String()
+	}
+	payload := `{"mac":"` + mac + `","ip":"` + ip.String() + `"}`
+	if pub.SendWith(topicNet, []byte(payload), 0, config.EventRetain) != sendSent {
+		return
+	}
+	logInfo("IP now " + ip.String())
+	lastIP = ip.String()
+}
+
+// whether the info is due again, given when it last went out. connectMQTT
+// sends it on every connect regardless.
+func infoDue(last time.Time) bool {
+	return config.InfoInterval > 0 && time.Since(last) >= config.InfoInterval
+}
+
+// Show config.SplashText with the version and device ID for
+// config.SplashDuration, so it is plain which build is flashed on which
+// board. Skipped when waking from deep sleep, so it only holds up the
+// first reading after power-on.
+func showSplash(display func(msg string)) {
+	if config.SplashDuration <= 0 || woke {
+		return
+	}
+	display(config.SplashText + " v" + Version + "\n" + topicID)
+	pause(config.SplashDuration)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+var errBadJSON = errors.New("bad JSON")
+
+// Parse a flat JSON object like {"line0":"Hi","backlight":true} into its
+// keys and values. Strings are unescaped; true, false, null and numbers
+// are kept as written. Nested objects and arrays are rejected. Written by
+// hand because encoding/json needs more reflection than TinyGo has.
+func parseJSONObject(s string) (map[string]string, error) {
+	p := jsonScanner{s: s}
+	fields := map[string]string{}
+	if !p.consume('{') {
+		return nil, errBadJSON
+	}
+	if p.consume('}') {
+		return fields, p.end()
+	}
+	for {
+		key, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(':') {
+			return nil, errBadJSON
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = val
+		if p.consume(',') {
+			continue
+		}
+		if p.consume('}') {
+			return fields, p.end()
+		}
+		return nil, errBadJSON
+	}
+}
+
+// jsonScanner walks s for parseJSONObject
+type jsonScanner struct {
+	s string
+	i int
+}
+
+func (p *jsonScanner) skipSpace() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\r', '\n':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// skip c (after any space), reporting whether it was there
+func (p *jsonScanner) consume(c byte) bool {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// check nothing but space is left
+func (p *jsonScanner) end() error {
+	p.skipSpace()
+	if p.i != len(p.s) {
+		return errBadJSON
+	}
+	return nil
+}
+
+// a string or a literal like true or 12.5
+func (p *jsonScanner) value() (string, error) {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == '"' {
+		return p.str()
+	}
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'E') {
+			break
+		}
+		p.i++
+	}
+	lit := p.s[start:p.i]
+	switch {
+	case lit == "true", lit == "false", lit == "null":
+		return lit, nil
+	case lit == "":
+		return "", errors.New("unsupported JSON value")
+	}
+	// ParseFloat alone would take Go forms JSON doesn't have, like inf,
+	// nan, +1, .5 and 0x10
+	if !jsonNumber(lit) {
+		return "", errBadJSON
+	}
+	if _, err := strconv.ParseFloat(lit, 32); err != nil {
+		return "", errBadJSON
+	}
+	return lit, nil
+}
+
+// report whether lit follows the JSON number grammar:
+// -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?
+func jsonNumber(lit string) bool {
+	i := 0
+	digits := func() int {
+		start := i
+		for i < len(lit) && lit[i] >= '0' && lit[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+	if i < len(lit) && lit[i] == '-' {
+		i++
+	}
+	if i < len(lit) && lit[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return false
+	}
+	if i < len(lit) && lit[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(lit) && (lit[i] == 'e' || lit[i] == 'E') {
+		i++
+		if i < len(lit) && (lit[i] == '-' || lit[i] == '+') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(lit)
+}
+
+// a quoted string, unescaped
+func (p *jsonScanner) str() (string, error) {
+	if !p.consume('"') {
+		return "", errBadJSON
+	}
+	var buf []byte
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '"':
+			return string(buf), nil
+		case c < ' ':
+			return "", errBadJSON
+		case c != '\\':
+			buf = append(buf, c)
+			continue
+		}
+		if p.i >= len(p.s) {
+			break
+		}
+		e := p.s[p.i]
+		p.i++
+		switch e {
+		case '"', '\\', '/':
+			buf = append(buf, e)
+		case 'n':
+			buf = append(buf, '\n')
+		case 't':
+			buf = append(buf, '\t')
+		case 'r', 'b', 'f':
+			// nothing the LCD can show
+		case 'u':
+			if p.i+4 > len(p.s) {
+				return "", errBadJSON
+			}
+			r, err := strconv.ParseUint(p.s[p.i:p.i+4], 16, 16)
+			if err != nil {
+				return "", errBadJSON
+			}
+			p.i += 4
+			buf = append(buf, string(rune(r))...)
+		default:
+			return "", errBadJSON
+		}
+	}
+	return "", errBadJSON
+}
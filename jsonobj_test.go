@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestParseJSONObjectNumbers(t *testing.T) {
+	tests := []struct {
+		num string
+		ok  bool
+	}{
+		{"0", true},
+		{"12", true},
+		{"-3", true},
+		{"12.5", true},
+		{"-0.25", true},
+		{"1e3", true},
+		{"1E-3", true},
+		{"2.5e+2", true},
+		{"inf", false},
+		{"nan", false},
+		{"infinity", false},
+		{"-inf", false},
+		{"+1", false},
+		{".5", false},
+		{"5.", false},
+		{"01", false},
+		{"0x10", false},
+		{"1e", false},
+		{"1e+", false},
+		{"-", false},
+		{"1e999", false}, // out of range
+	}
+	for _, tt := range tests {
+		fields, err := parseJSONObject(`{"v":` + tt.num + `}`)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: err = %v, want ok %t", tt.num, err, tt.ok)
+			continue
+		}
+		if tt.ok && fields["v"] != tt.num {
+			t.Errorf("%s: value = %q", tt.num, fields["v"])
+		}
+	}
+}
+
+func TestParseJSONObject(t *testing.T) {
+	fields, err := parseJSONObject(` {"line0": "Hi!", "backlight" : true, "n":null} `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"line0": "Hi!", "backlight": "true", "n": "null"}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+	for _, bad := range []string{``, `{`, `{"a":1,}`, `{"a":[1]}`, `{"a":{}}`, `{"a":1} x`, `{"a":yes}`} {
+		if _, err := parseJSONObject(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
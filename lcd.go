@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// geometry of the character LCD
+var (
+	lcdWidth  = config.LCDWidth
+	lcdHeight = config.LCDHeight
+)
+
+// delay between marquee steps for messages wider than the LCD
+const scrollStep = 400 * time.Millisecond
+
+var (
+	// serializes drawing between message handlers and the marquee
+	lcdMu sync.Mutex
+
+	// closed to cancel the running marquee
+	stopScroll chan struct{}
+
+	// message lcdDisp last drew, "" after anything else cleared the screen
+	lcdShown string
+
+	// backlight state and the timer that turns it off when idle
+	backlightOn    = true
+	backlightTimer *time.Timer
+)
+
+// check the configured geometry fits the HD44780's 80 bytes of DDRAM.
+// Rows 2 and 3 of a 4-row module continue rows 0 and 1 at column 20,
+// so 3 or 4 rows allow at most 20 columns.
+func checkLCDGeometry() error {
+	switch {
+	case lcdHeight < 1 || lcdHeight > 4:
+		return errors.New("LCD height must be 1 to 4 rows")
+	case lcdWidth < 1 || lcdWidth > 40:
+		return errors.New("LCD width must be 1 to 40 columns")
+	case lcdHeight > 2 && lcdWidth > 20:
+		return errors.New("LCDs with more than 2 rows have at most 20 columns")
+	}
+	return nil
+}
+
+// I2C addresses LCD backpacks commonly use
+var lcdAddresses = []uint8{0x27, 0x3F}
+
+// and those SSD1306 OLEDs do
+var oledAddresses = []uint8{0x3C, 0x3D}
+
+// report whether a device ACKs at addr
+func i2cPresent(bus *machine.I2C, addr uint8) bool {
+	return bus.Tx(uint16(addr), nil, []byte{0}) == nil
+}
+
+// address of the LCD: addr if it answers, otherwise (with config.LCDProbe)
+// whichever of the common backpack addresses does
+func findLCDAddress(bus *machine.I2C, addr uint8) uint8 {
+	if i2cPresent(bus, addr) || !config.LCDProbe {
+		return addr
+	}
+	logError("no LCD at 0x" + strconv.FormatUint(uint64(addr), 16) + ", probing")
+	for _, a := range lcdAddresses {
+		if a != addr && i2cPresent(bus, a) {
+			logInfo("LCD found at 0x" + strconv.FormatUint(uint64(a), 16))
+			return a
+		}
+	}
+	logError("no LCD found")
+	return addr
+}
+
+// show msg on the LCD between config.LCDPrefix and config.LCDSuffix,
+// wrapping or scrolling it when it is too wide for all three. A message
+// identical to the one on screen is not redrawn, to avoid flicker, and
+// neither wakes the backlight nor ends the screensaver, so a steady
+// reading redrawn every interval lets the backlight time out.
+func lcdDisp(lcd Displayer, msg string) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	if msg == lcdShown {
+		return
+	}
+	wake(lcd)
+	saverOn = false
+	lastChange = time.Now()
+	stopScrolling()
+	lcdShown = msg
+
+	lcd.Clear()
+	time.Sleep(20 * time.Millisecond)
+
+	if msg == "unko" {
+		lcd.Print([]byte("    "))
+		renderGlyph(lcd, glyphUnkoLeft)
+		renderGlyph(lcd, glyphUnkoRight)
+		lcd.Print([]byte(msg))
+		renderGlyph(lcd, glyphUnkoLeft)
+		renderGlyph(lcd, glyphUnkoRight)
+		return
+	}
+
+	msg = toROM(config.LCDPrefix + msg + config.LCDSuffix)
+	if len(msg) > lcdWidth || strings.Contains(msg, "\n") {
+		if lines, ok := wrap(msg, lcdWidth, lcdHeight); ok {
+			for row, line := range lines {
+				lcd.SetCursor(0, row)
+				lcd.Print([]byte(line))
+			}
+			return
+		}
+
+		// too many lines for the rows: join them, scrolling only if that
+		// is still too wide
+		msg = strings.ReplaceAll(msg, "\n", " ")
+		if len(msg) <= lcdWidth {
+			lcd.Print([]byte(msg))
+			return
+		}
+		lcd.Print([]byte(msg[:lcdWidth]))
+		stopScroll = make(chan struct{})
+		stop := stopScroll
+		goSafe("marquee", func() {
+			scroll(lcd, msg, stop)
+		})
+		return
+	}
+
+	lcd.Print([]byte(msg))
+}
+
+// switch the backlight, skipping the I2C write when nothing changes.
+// lcdMu must be held.
+func setBacklight(lcd Displayer, on bool) {
+	if on == backlightOn {
+		return
+	}
+	lcd.Backlight(on)
+	backlightOn = on
+}
+
+// turn the backlight on, unless the room is dark or (with a PIR sensor)
+// empty, and restart the idle timeout. lcdMu must be held.
+func wake(lcd Displayer) {
+	setBacklight(lcd, !ambientDark && present())
+	if config.BacklightTimeout <= 0 {
+		return
+	}
+	if backlightTimer == nil {
+		backlightTimer = time.AfterFunc(config.BacklightTimeout, func() {
+			lcdMu.Lock()
+			setBacklight(lcd, false)
+			lcdMu.Unlock()
+		})
+		return
+	}
+	backlightTimer.Reset(config.BacklightTimeout)
+}
+
+// turn the backlight back on for a message that arrived, even one that
+// repeats what is on screen, unless the screensaver is on
+func wakeForMessage(lcd Displayer) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	if !saverOn {
+		wake(lcd)
+	}
+}
+
+// break msg into lines of at most width characters, at each newline and on
+// spaces where possible. ok is false when it needs more than height lines.
+func wrap(msg string, width, height int) (lines []string, ok bool) {
+	for _, para := range strings.Split(msg, "\n") {
+		for len(para) > width {
+			if len(lines) == height {
+				return nil, false
+			}
+			cut := strings.LastIndexByte(para[:width+1], ' ')
+			if cut <= 0 {
+				lines = append(lines, para[:width])
+				para = para[width:]
+			} else {
+				lines = append(lines, para[:cut])
+				para = para[cut+1:]
+			}
+		}
+		lines = append(lines, para)
+	}
+	return lines, len(lines) <= height
+}
+
+// shift msg left one character every scrollStep until its end is on screen,
+// then hold it there. Returns early once stop is closed.
+func scroll(lcd Displayer, msg string, stop chan struct{}) {
+	for i := 1; i+lcdWidth <= len(msg); i++ {
+		select {
+		case <-stop:
+			return
+		case <-time.After(scrollStep):
+		}
+
+		if !drawScroll(lcd, msg[i:i+lcdWidth], stop) {
+			return
+		}
+	}
+}
+
+// draw one marquee step, unless stop was closed meanwhile, reporting
+// whether it did
+func drawScroll(lcd Displayer, text string, stop chan struct{}) bool {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	lcd.SetCursor(0, 0)
+	lcd.Print([]byte(text))
+	return true
+}
+
+// cancel the running marquee, if any. lcdMu must be held.
+func stopScrolling() {
+	if stopScroll != nil {
+		close(stopScroll)
+		stopScroll = nil
+	}
+}
+
+// horizontal placement of text within a row
+type align int
+
+const (
+	alignLeft align = iota
+	alignCenter
+	alignRight
+)
+
+// print text on row placed according to a, padding with spaces so the
+// whole row is overwritten. Text wider than the LCD is cut. lcdMu must be
+// held.
+func printAligned(lcd Displayer, row int, text string, a align) {
+	if len(text) > lcdWidth {
+		text = text[:lcdWidth]
+	}
+	pad := lcdWidth - len(text)
+	left := 0
+	switch a {
+	case alignCenter:
+		left = pad / 2
+	case alignRight:
+		left = pad
+	}
+	lcd.SetCursor(0, row)
+	lcd.Print([]byte(strings.Repeat(" ", left) + text + strings.Repeat(" ", pad-left)))
+}
+
+// Show text on row alone, clamped to the last one, so sources owning
+// different rows don't clobber each other. Ends a marquee, which would
+// draw over it.
+func lcdRow(lcd Displayer, row int, text string) {
+	if row >= lcdHeight {
+		row = lcdHeight - 1
+	}
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	wake(lcd)
+	if saverOn {
+		saverOn = false
+		lcd.Clear()
+	}
+	lastChange = time.Now()
+	stopScrolling()
+	lcdShown = ""
+	printAligned(lcd, row, toROM(text), alignLeft)
+}
+
+// Show rows[i] on row i, each cut to the LCD width, and blank the rest,
+// so no row's text can run into the next. Ends a marquee.
+func lcdRows(lcd Displayer, rows []string) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	wake(lcd)
+	saverOn = false
+	lastChange = time.Now()
+	stopScrolling()
+	lcdShown = ""
+	for row := 0; row < lcdHeight; row++ {
+		text := ""
+		if row < len(rows) {
+			text = toROM(rows[row])
+		}
+		printAligned(lcd, row, text, alignLeft)
+	}
+}
+
+// row a topic ending in /line<n> owns on the LCD
+func topicRow(topic string) (row int, ok bool) {
+	i := strings.LastIndex(topic, "/line")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(topic[i+len("/line"):], 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// show msg on the bottom row, leaving the rest of the display alone
+func lcdStatus(lcd Displayer, msg string) {
+	lcdStatusAligned(lcd, msg, alignLeft)
+}
+
+// show msg on the bottom row placed according to a, unless the
+// screensaver is on. A status that differs from the last one keeps the
+// screensaver away, as a ticking clock should.
+func lcdStatusAligned(lcd Displayer, msg string, a align) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	if saverOn {
+		return
+	}
+	if msg != statusShown {
+		statusShown = msg
+		lastChange = time.Now()
+	}
+	printAligned(lcd, lcdHeight-1, msg, a)
+}
+
+// run msg as an LCD command (clear, backlight:on, backlight:off,
+// bar:<percent> or char:<hex>), reporting whether it was one. clear also
+// makes the next message redraw even if it repeats the last one.
+func lcdCommand(lcd Displayer, msg string) bool {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+
+	switch {
+	case msg == "clear":
+		stopScrolling()
+		lcd.Clear()
+		lcdShown = ""
+	case msg == "backlight:on":
+		setBacklight(lcd, true)
+	case msg == "backlight:off":
+		setBacklight(lcd, false)
+	case strings.HasPrefix(msg, "bar:"):
+		pct, err := strconv.ParseUint(strings.TrimPrefix(msg, "bar:"), 10, 8)
+		if err != nil {
+			return false
+		}
+		renderBar(lcd, lcdHeight-1, float32(pct)/100)
+	case strings.HasPrefix(msg, "char:"):
+		c, err := strconv.ParseUint(strings.TrimPrefix(msg, "char:"), 16, 8)
+		if err != nil {
+			return false
+		}
+		stopScrolling()
+		lcd.Clear()
+		lcdShown = ""
+		time.Sleep(20 * time.Millisecond)
+		lcd.Print([]byte{byte(c)})
+	default:
+		return false
+	}
+	return true
+}
+
+// show msg and blink the backlight a few times so an alert stands out
+func lcdAlert(lcd Displayer, msg string) {
+	lcdDisp(lcd, msg)
+
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+	for i := 0; i < 3; i++ {
+		setBacklight(lcd, false)
+		time.Sleep(200 * time.Millisecond)
+		setBacklight(lcd, true)
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func mLcdDisp(lcd Displayer) func(msg string) {
+	return func(msg string) {
+		lcdDisp(lcd, msg)
+	}
+}
+
+func mLcdStatus(lcd Displayer) func(msg string) {
+	return func(msg string) {
+		lcdStatus(lcd, msg)
+	}
+}
+
+func mLcdAlert(lcd Displayer) func(msg string) {
+	return func(msg string) {
+		lcdAlert(lcd, msg)
+	}
+}
+
+func mLcdStatusCentered(lcd Displayer) func(msg string) {
+	return func(msg string) {
+		lcdStatusAligned(lcd, msg, alignCenter)
+	}
+}
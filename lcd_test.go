@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// the text on row of d, trailing spaces and all
+func rowText(d *serialDisplay, row int) string {
+	return string(d.rows[row])
+}
+
+func TestLcdDispMoreLinesThanRows(t *testing.T) {
+	d := newSerialDisplay()
+	lcdShown = ""
+	// used to panic slicing the joined text to the LCD width
+	lcdDisp(d, "a\nb\nc")
+	if got, want := rowText(d, 0), "a b c           "; got != want {
+		t.Errorf("row 0 = %q, want %q", got, want)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		msg    string
+		width  int
+		height int
+		lines  []string
+		ok     bool
+	}{
+		{"hello", 16, 2, []string{"hello"}, true},
+		{"hello world", 5, 2, []string{"hello", "world"}, true},
+		{"a\nb", 16, 2, []string{"a", "b"}, true},
+		{"a\nb\nc", 16, 2, nil, false},
+		{"abcdefghij", 4, 2, nil, false},
+	}
+	for _, tt := range tests {
+		lines, ok := wrap(tt.msg, tt.width, tt.height)
+		if ok != tt.ok || ok && len(lines) != len(tt.lines) {
+			t.Errorf("wrap(%q, %d, %d) = %q, %v; want %q, %v", tt.msg, tt.width, tt.height, lines, ok, tt.lines, tt.ok)
+			continue
+		}
+		for i := range tt.lines {
+			if lines[i] != tt.lines[i] {
+				t.Errorf("wrap(%q) line %d = %q, want %q", tt.msg, i, lines[i], tt.lines[i])
+			}
+		}
+	}
+}
+
+func TestLcdDispRepeatKeepsBacklightOff(t *testing.T) {
+	d := newSerialDisplay()
+	lcdShown = ""
+	lcdDisp(d, "T:22.5C H:40%")
+	lcdMu.Lock()
+	setBacklight(d, false)
+	lcdMu.Unlock()
+
+	// what loop() does every interval with a steady sensor
+	lcdDisp(d, "T:22.5C H:40%")
+	if backlightOn {
+		t.Error("repeated message turned the backlight back on")
+	}
+	lcdDisp(d, "T:22.6C H:40%")
+	if !backlightOn {
+		t.Error("new message left the backlight off")
+	}
+}
+
+func TestStatusChangeKeepsScreensaverAway(t *testing.T) {
+	d := newSerialDisplay()
+	saverOn = false
+	lcdStatus(d, "12:00:00")
+	lastChange = time.Now().Add(-time.Hour)
+
+	lcdStatus(d, "12:00:00")
+	if time.Since(lastChange) < time.Minute {
+		t.Error("repeating a status counted as a change")
+	}
+	lcdStatus(d, "12:00:01")
+	if time.Since(lastChange) > time.Minute {
+		t.Error("a new status didn't count as a change")
+	}
+}
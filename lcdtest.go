@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+// Check every cell, pixel and CGRAM slot of a new display: fill it with
+// the solid block, then with each of the 8 slots lighting a different
+// pixel row, and blink the backlight. Takes about 5 seconds, after which
+// the screen is blank and the usual glyphs are back.
+func lcdTest(lcd Displayer) {
+	logInfo("LCD test")
+	lcdMu.Lock()
+	stopScrolling()
+
+	fillLCD(lcd, func(x, y int) byte { return glyphFullBlock })
+	time.Sleep(1500 * time.Millisecond)
+
+	for slot := 0; slot < 8; slot++ {
+		pattern := make([]byte, 8)
+		pattern[slot] = 0x1F
+		lcd.CreateGlyph(uint8(slot), pattern)
+	}
+	// diagonal stripes, so every slot lands in every column sooner or later
+	fillLCD(lcd, func(x, y int) byte { return byte((x + y) % 8) })
+	time.Sleep(1500 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		lcd.Backlight(false)
+		time.Sleep(400 * time.Millisecond)
+		lcd.Backlight(true)
+		time.Sleep(400 * time.Millisecond)
+	}
+	backlightOn = true
+
+	lcd.Clear()
+	lcdShown = ""
+	lcdMu.Unlock()
+	loadGlyphs(lcd)
+}
+
+// print code(x, y) in every cell. lcdMu must be held.
+func fillLCD(lcd Displayer, code func(x, y int) byte) {
+	row := make([]byte, lcdWidth)
+	for y := 0; y < lcdHeight; y++ {
+		for x := range row {
+			row[x] = code(x, y)
+		}
+		lcd.SetCursor(0, y)
+		lcd.Print(row)
+	}
+}
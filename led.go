@@ -0,0 +1,62 @@
+package main
+
+import (
+	"machine"
+	"time"
+)
+
+// connection state shown on the status LED
+type ledState uint8
+
+const (
+	ledConnectingAP   ledState = iota // slow blink
+	ledConnectingMQTT                 // fast blink
+	ledConnected                      // solid
+	ledFatal                          // SOS
+)
+
+// alternating on/off times for each state, repeated; nil means solid on
+var ledPatterns = [...][]time.Duration{
+	ledConnectingAP:   {500 * time.Millisecond, 500 * time.Millisecond},
+	ledConnectingMQTT: {100 * time.Millisecond, 100 * time.Millisecond},
+	ledConnected:      nil,
+	ledFatal: {
+		200 * time.Millisecond, 200 * time.Millisecond, // S
+		200 * time.Millisecond, 200 * time.Millisecond,
+		200 * time.Millisecond, 600 * time.Millisecond,
+		600 * time.Millisecond, 200 * time.Millisecond, // O
+		600 * time.Millisecond, 200 * time.Millisecond,
+		600 * time.Millisecond, 600 * time.Millisecond,
+		200 * time.Millisecond, 200 * time.Millisecond, // S
+		200 * time.Millisecond, 200 * time.Millisecond,
+		200 * time.Millisecond, 1400 * time.Millisecond,
+	},
+}
+
+// state the LED goroutine is showing
+var ledCurrent = ledConnectingAP
+
+func setLED(state ledState) {
+	ledCurrent = state
+}
+
+// drive the LED on pin from ledCurrent forever
+func runLED(pin machine.Pin) {
+	pin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	for {
+		state := ledCurrent
+		pattern := ledPatterns[state]
+		if pattern == nil {
+			pin.High()
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		for i, d := range pattern {
+			if ledCurrent != state {
+				break
+			}
+			pin.Set(i%2 == 0)
+			time.Sleep(d)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"time"
+)
+
+// dimmer is a Displayer whose backlight can be dimmed, not just switched
+type dimmer interface {
+	SetBrightness(level uint8)
+}
+
+// hysteresis of the backlight switch on displays without dimming, in
+// lightLevel steps, so dusk doesn't make it flicker
+const (
+	lightOffBelow = 96
+	lightOnAbove  = 160
+)
+
+// the room is too dark for the backlight, as measured on config.LightPin;
+// wake leaves it off then
+var ambientDark bool
+
+// Map a reading of the light sensor divider (higher is brighter) onto a
+// backlight level: min at or below dark, 255 at or above bright and
+// linear in between.
+func lightLevel(raw, dark, bright uint16, min uint8) uint8 {
+	switch {
+	case bright <= dark, raw >= bright:
+		return 255
+	case raw <= dark:
+		return min
+	}
+	return min + uint8(uint32(255-min)*uint32(raw-dark)/uint32(bright-dark))
+}
+
+// lcd as a dimmer, if the display behind it can dim. Looked up on every
+// use, as a guardedDisplay may bind a new driver at any time.
+func canDimmer(lcd Displayer) (dimmer, bool) {
+	inner := lcd
+	if g, ok := lcd.(*guardedDisplay); ok {
+		inner = g.Displayer
+	}
+	if _, ok := inner.(dimmer); !ok {
+		return nil, false
+	}
+	dim, ok := lcd.(dimmer)
+	return dim, ok
+}
+
+// Follow the ambient light on config.LightPin: dim displays that can dim
+// (the OLED), switch the backlight of those that can't. Smoothed over a
+// few seconds so a passing shadow does nothing.
+func runLightSensor(lcd Displayer) {
+	if config.LightPin == machine.NoPin {
+		return
+	}
+	machine.InitADC()
+	adc := machine.ADC{Pin: config.LightPin}
+	adc.Configure(machine.ADCConfig{})
+
+	avg := newSmoother(8)
+	for {
+		avg.Add(float32(adc.Get()))
+		level := lightLevel(uint16(avg.Mean()), config.LightDark, config.LightBright, config.LightMin)
+
+		lcdMu.Lock()
+		dim, canDim := canDimmer(lcd)
+		switch {
+		case canDim:
+			dim.SetBrightness(level)
+		case level < lightOffBelow && !ambientDark:
+			ambientDark = true
+			setBacklight(lcd, false)
+		case level > lightOnAbove && ambientDark:
+			ambientDark = false
+			wake(lcd)
+		}
+		lcdMu.Unlock()
+		time.Sleep(500 * time.Millisecond)
+	}
+}
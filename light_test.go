@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestLightLevel(t *testing.T) {
+	tests := []struct {
+		raw, dark, bright uint16
+		min               uint8
+		want              uint8
+	}{
+		{0, 1000, 5000, 16, 16},      // darker than dark
+		{1000, 1000, 5000, 16, 16},   // at dark
+		{3000, 1000, 5000, 16, 135},  // half way: 16 + 239/2
+		{4999, 1000, 5000, 16, 254},  // just under bright
+		{5000, 1000, 5000, 16, 255},  // at bright
+		{65535, 1000, 5000, 16, 255}, // brighter than bright
+		{3000, 1000, 5000, 0, 127},   // no minimum
+		{3000, 1000, 5000, 255, 255}, // minimum at full
+		{3000, 5000, 5000, 16, 255},  // dark == bright: always full
+		{3000, 6000, 5000, 16, 255},  // dark above bright
+	}
+	for _, tt := range tests {
+		if got := lightLevel(tt.raw, tt.dark, tt.bright, tt.min); got != tt.want {
+			t.Errorf("lightLevel(%d, %d, %d, %d) = %d, want %d", tt.raw, tt.dark, tt.bright, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// how often the limiter logs while it is dropping messages
+const limitLogWindow = 10 * time.Second
+
+// limiter is a token bucket allowing rate messages per second on average
+// with bursts of up to burst. clock is time.Now outside of tests.
+type limiter struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	clock   func() time.Time
+	dropped int
+	logged  time.Time // when a drop was last logged, zero if never
+}
+
+// new limiter starting with a full bucket; a rate of 0 or less allows
+// everything
+func newLimiter(rate float64, burst int, clock func() time.Time) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: clock(), clock: clock}
+}
+
+// take a token if there is one, reporting whether the message may be sent.
+// Refused messages are counted and dropped by the caller, and logged at
+// most once per limitLogWindow so a flood doesn't flood the log too.
+func (l *limiter) allow() bool {
+	if l.rate <= 0 {
+		return true
+	}
+	t := l.clock()
+	l.tokens += t.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = t
+
+	if l.tokens < 1 {
+		l.dropped++
+		if l.logged.IsZero() || t.Sub(l.logged) >= limitLogWindow {
+			logError("rate limited, dropped " + strconv.Itoa(l.dropped) + " messages")
+			l.logged = t
+		}
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(2, 3, func() time.Time { return now })
+
+	// a full bucket lets the burst through, then refuses
+	for i := 0; i < 3; i++ {
+		if !l.allow() {
+			t.Fatalf("burst message %d refused", i+1)
+		}
+	}
+	if l.allow() {
+		t.Fatal("message past the burst allowed")
+	}
+
+	// at 2 a second, half a second earns one token
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow() {
+		t.Fatal("refilled token refused")
+	}
+	if l.allow() {
+		t.Fatal("second message after half a second allowed")
+	}
+
+	// a long pause refills to the burst and no further
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !l.allow() {
+			t.Fatalf("message %d after refill refused", i+1)
+		}
+	}
+	if l.allow() {
+		t.Fatal("bucket filled past the burst")
+	}
+	if l.dropped != 3 {
+		t.Errorf("dropped = %d, want 3", l.dropped)
+	}
+}
+
+func TestLimiterLogsOncePerWindow(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := start
+	l := newLimiter(0.001, 1, func() time.Time { return now })
+	l.allow()
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		l.allow()
+	}
+	if want := start.Add(time.Second); !l.logged.Equal(want) {
+		t.Errorf("drops within a window logged at %v, want only the first at %v", l.logged, want)
+	}
+
+	now = now.Add(limitLogWindow)
+	l.allow()
+	if !l.logged.Equal(now) {
+		t.Errorf("first drop of the next window not logged")
+	}
+	if l.dropped != 6 {
+		t.Errorf("dropped = %d, want 6", l.dropped)
+	}
+}
+
+func TestLimiterNoRate(t *testing.T) {
+	l := newLimiter(0, 1, time.Now)
+	for i := 0; i < 100; i++ {
+		if !l.allow() {
+			t.Fatal("a rate of 0 refused a message")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"time"
+)
+
+// when the program started, for uptime stamps; main sets it again first
+// thing so it doesn't depend on package init order
+var bootTime = time.Now()
+
+// Write msg to the serial console if level is at least config.LogLevel.
+// The console writers are used rather than fmt to keep allocations down.
+func logMsg(level int, prefix string, msg string) {
+	if level < config.LogLevel {
+		return
+	}
+	if config.LogTimestamps {
+		consoleWriteInt(time.Since(bootTime).Milliseconds())
+		consoleWrite(" ")
+	}
+	consoleWrite(prefix)
+	consoleWrite(msg)
+	consoleWrite("\n")
+}
+
+func logDebug(msg string) {
+	logMsg(config.LogDebug, "D ", msg)
+}
+
+func logInfo(msg string) {
+	logMsg(config.LogInfo, "I ", msg)
+}
+
+func logError(msg string) {
+	logMsg(config.LogError, "E ", msg)
+}
@@ -7,29 +7,71 @@
 //
 // You must install the Paho MQTT package to build this program:
 //
-// 		go get -u github.com/eclipse/paho.mqtt.golang
-//
+//	go get -u github.com/eclipse/paho.mqtt.golang
 package main
 
 import (
+	"device/sam"
+	"errors"
 	"fmt"
 	"github.com/amanoese/belltomo/config"
 	"machine"
 	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 	"tinygo.org/x/drivers/hd44780i2c"
 	"tinygo.org/x/drivers/net/mqtt"
+	"tinygo.org/x/drivers/ssd1306"
 	"tinygo.org/x/drivers/wifinina"
+	"unicode/utf8"
 )
 
-// access point info
-var ssid = config.SSID
-var pass = config.PASS
+// time between published readings
+var publishInterval = config.PublishInterval
+
+// time between WiFi connection status checks
+var wifiPollInterval = config.WiFiPollInterval
+
+// URL of the MQTT broker to use.
+//
+// With ssl:// the NINA firmware does the TLS handshake itself. It only speaks
+// TLS 1.2 (ECDHE/RSA with AES-GCM or AES-CBC), has no client certificates and
+// checks the broker against the root CAs bundled in the firmware, so the
+// broker certificate must chain to one of those (more can be added with the
+// Arduino firmware updater). That is why ssl://test.mosquitto.org:8883, signed
+// by the mosquitto CA, fails while port 8886 (Let's Encrypt) works.
+var server = config.Broker
+
+// QoS for the rx subscription and published readings.
+//
+// The tinygo mqtt client sends QoS 1/2 packets but ignores PUBACK, so a token
+// only reports errors writing to the NINA socket, not lost deliveries. It
+// keeps up with QoS 1 at a one second publish interval because nothing is
+// waited for.
+var qos = config.QoS
+
+// how often the WiFi signal strength on the LCD is refreshed
+const rssiInterval = 5 * time.Second
+
+// number of reconnect attempts before the broker is considered dead
+const maxReconnect = 10
+
+// passed to the connection lost handler to move back to the primary broker
+// the board came back from deepSleep rather than being powered up, so the
+// LCD is already up and the splash was seen on the first boot
+var woke bool
 
-// IP address of the MQTT broker to use. Replace with your own info.
-const server = "tcp://test.mosquitto.org:1883"
+var errFailback = errors.New("trying the primary broker again")
 
-//const server = "ssl://test.mosquitto.org:8883"
+// a connection lost sooner than this after connecting counts towards a
+// suspected client ID collision
+const collisionWindow = 30 * time.Second
+
+// MQTT keep-alive. The broker drops a client that sends nothing for one
+// and a half times this, so loop() republishes the status when readings
+// have not gone out for half of it.
+var keepAlive = time.Duration(config.KeepAlive) * time.Second
 
 // change these to connect to a different UART or pins for the ESP8266/ESP32
 var (
@@ -39,141 +81,757 @@ var (
 	// this is the ESP chip that has the WIFININA firmware flashed on it
 	adaptor *wifinina.Device
 
-	cl      mqtt.Client
-	topicTx = "tinygo/tx"
-	topicRx = "tinygo/rx"
+	cl         mqtt.Client
+	subHandler mqtt.MessageHandler
+
+	// options the client was made with; it reads ClientID from them on
+	// every Connect
+	mqttOpts *mqtt.ClientOptions
+
+	// set by setupTopics from config.TopicPrefix
+	topicTx     string
+	topicsRx    []string
+	topicStatus string
+
+	// the rx topics from config.BinaryRxTopics, shown as hex
+	topicsBinary []string
+
+	// caps everything published at config.MaxPublishRate while connected
+	publishLimit = newLimiter(config.MaxPublishRate, config.PublishBurst, time.Now)
+
+	// closed through requestShutdown so loop() returns and main() can
+	// disconnect
+	shutdown = make(chan struct{})
 )
 
-func lcdDisp(lcd *hd44780i2c.Device, msg string) {
-	lcd.ClearDisplay()
-	time.Sleep(20 * time.Millisecond)
-
-	if msg == "unko" {
-		lcd.CreateCharacter(0x0, []byte{0x01, 0x03, 0x04, 0x07, 0x08, 0x0F, 0x10, 0x1F})
-		lcd.CreateCharacter(0x1, []byte{0x10, 0x18, 0x04, 0x1C, 0x02, 0x1E, 0x01, 0x1F})
-		lcd.Print([]byte("    "))
-		lcd.Print([]byte{0x0, 0x1})
-		lcd.Print([]byte(msg))
-		lcd.Print([]byte{0x0, 0x1})
-		return
+// Message handler for the rx subscriptions: logs each message and passes
+// it on to the routes set up by setupRoutes.
+func getSubHandler(lcd Displayer) func(client mqtt.Client, msg mqtt.Message) {
+	setupRoutes(lcd)
+	return func(client mqtt.Client, msg mqtt.Message) {
+		topic := msg.Topic()
+		payload := msg.Payload()
+		defer recoverMessage(lcd, topic)
+		if len(payload) == 0 {
+			logInfo("[" + topic + "] empty payload")
+			return
+		}
+		counters.received++
+		wakeForMessage(lcd)
+		text := displayText(payload, config.MaxDisplayLen)
+		if isBinaryTopic(topic) {
+			text = hexDump(payload, config.MaxDisplayLen)
+		}
+		logInfo("[" + topic + "] (" + strconv.Itoa(len(payload)) + " bytes) " + text)
+		dispatch(topic, payload)
+	}
+}
+
+// Route the control topic to controlCommand, rx topics ending in
+// /backlight to the backlight, those ending in /line<n> to their row, and
+// everything else to the LCD commands or the display itself. Messages for
+// the whole screen are coalesced over config.LCDCoalesce.
+func setupRoutes(lcd Displayer) {
+	screen := newCoalescer(lcd, config.LCDCoalesce, time.Now, time.Sleep)
+	if topicControl != "" {
+		onTopic(topicControl, func(payload []byte) {
+			controlCommand(lcd, payload)
+		})
+	}
+	for _, t := range topicsBinary {
+		onTopic(t, func(payload []byte) {
+			screen.show(hexDump(payload, lcdWidth*lcdHeight/3))
+		})
+	}
+	for _, t := range topicsRx {
+		if strings.HasSuffix(t, "/backlight") {
+			onTopic(t, func(payload []byte) {
+				lcdCommand(lcd, "backlight:"+displayText(payload, config.MaxDisplayLen))
+			})
+		}
+		if row, ok := topicRow(t); ok {
+			onTopic(t, func(payload []byte) {
+				lcdRow(lcd, row, displayText(payload, config.MaxDisplayLen))
+			})
+		}
 	}
 
-	lcd.Print([]byte(msg))
+	onOtherTopics(func(payload []byte) {
+		str := displayText(payload, config.MaxDisplayLen)
+		if config.Rotate && rotationCommand(str) {
+			return
+		}
+		if lcdCommand(lcd, str) {
+			return
+		}
+		if config.Rotate {
+			rotation.set(itemRx, str)
+			rotation.show(itemRx)
+			return
+		}
+		screen.show(str)
+	})
 }
 
-func mLcdDisp(lcd *hd44780i2c.Device) func(msg string) {
-	return func(msg string) {
-		lcdDisp(lcd, msg)
+// payload as a string of at most max bytes, cut at a character boundary
+// and ended with "..." if it is longer, so a huge message is not copied
+// whole just to be shown on a few dozen characters
+func displayText(payload []byte, max int) string {
+	if max <= 0 || len(payload) <= max {
+		return string(payload)
 	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(payload[cut]) {
+		cut--
+	}
+	return string(payload[:cut]) + "..."
 }
 
-func getSubHandler(lcd *hd44780i2c.Device) func(client mqtt.Client, msg mqtt.Message) {
-	return func(client mqtt.Client, msg mqtt.Message) {
-		topic := msg.Topic()
-		payload := msg.Payload()
-		str := fmt.Sprintf("%s", payload)
+// subscribe handler to every rx topic, failing on the first one the
+// client rejects
+func subscribe(cl mqtt.Client, handler mqtt.MessageHandler) error {
+	for _, topic := range topicsRx {
+		token := cl.Subscribe(topic, qos, handler)
+		if token.Wait() && token.Error() != nil {
+			return errors.New("subscribe " + topic + ": " + token.Error().Error())
+		}
+	}
+	return nil
+}
 
-		fmt.Printf("[%s]  ", topic)
-		fmt.Printf("%s\r\n", payload)
+// connect client to the broker, subscribe handler to the rx topics and
+// announce the node as online
+func connectMQTT(client mqtt.Client, handler mqtt.MessageHandler) error {
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	// subscriptions are not restored by the broker, so subscribe again
+	if err := subscribe(client, handler); err != nil {
+		return err
+	}
+	publishStatus("online")
+	publishInfo()
+	return nil
+}
 
-		lcdDisp(lcd, str)
+// The tinygo mqtt client has no SetConnectionLostHandler, so the Publisher
+// calls the returned handler itself when a publish fails.
+//
+// A broker drops the older of two clients with the same ID, so two nodes
+// sharing one kick each other off for ever. After config.CollisionLosses
+// losses in a row each within collisionWindow of connecting, the client ID
+// gets a random suffix.
+func getConnectionLostHandler(subHandler mqtt.MessageHandler, display func(msg string)) func(client mqtt.Client, err error) {
+	connectedAt := time.Now()
+	quickLosses := 0
+	return func(client mqtt.Client, err error) {
+		logError("MQTT connection lost: " + err.Error())
+		display("MQTT lost")
+		setLED(ledConnectingMQTT)
+
+		if time.Since(connectedAt) < collisionWindow {
+			quickLosses++
+		} else {
+			quickLosses = 0
+		}
+		if config.CollisionLosses > 0 && quickLosses >= config.CollisionLosses && mqttOpts != nil {
+			id := mqttOpts.ClientID + "-" + randomString(4)
+			logError("client ID collision suspected, now " + id)
+			mqttOpts.SetClientID(id)
+			quickLosses = 0
+		}
+
+		if onSecondary() && err == errFailback {
+			useBroker(config.Broker, display)
+		}
+		lostAt := time.Now()
+		b := NewBackoff(1*time.Second, 30*time.Second)
+		for i := 0; i < maxReconnect; i++ {
+			pause(b.Next())
+
+			if url := failover(time.Since(lostAt)); url != server {
+				useBroker(url, display)
+				lostAt = time.Now()
+			}
+			logInfo("Reconnecting to MQTT broker at " + server)
+			client.Disconnect(100)
+			if err := connectMQTT(client, subHandler); err != nil {
+				logError(err.Error())
+				continue
+			}
+
+			counters.reconnects++
+			connectedAt = time.Now()
+			display("MQTT reconnected")
+			setLED(ledConnected)
+			return
+		}
+
+		display("MQTT broker dead")
+		failMessage("gave up reconnecting to " + server)
 	}
 }
 
-func main() {
-	machine.I2C0.Configure(machine.I2CConfig{
-		Frequency: machine.TWI_FREQ_400KHZ,
+// Join an access point, retrying up to config.MaxAttempts times.
+func setupWiFi(display func(msg string)) error {
+	display("connect to AP...")
+	setLED(ledConnectingAP)
+	err := attempt("WiFi connect failed", func() error {
+		return connectToAP(display)
 	})
-	lcd := hd44780i2c.New(machine.I2C0, 0x3F) // some modules have address 0x3F
+	if err != nil {
+		return err
+	}
+	display("connected AP")
+	return nil
+}
+
+// Connect to the broker, making the client the first time, then announce
+// the node and subscribe subHandler to the rx topics. Connect and
+// subscribe are each tried up to config.MaxAttempts times.
+func setupMQTT(display func(msg string)) error {
+	if cl == nil {
+		opts := mqtt.NewClientOptions()
+		mqttOpts = opts
+		opts.AddBroker(server).SetClientID(clientID())
+		if config.MQTTUser != "" {
+			// the password is never logged
+			logInfo("MQTT user " + config.MQTTUser)
+			opts.SetUsername(config.MQTTUser)
+			opts.SetPassword(config.MQTTPassword)
+		}
+		// v0.17 of the tinygo mqtt client keeps the will but does not send
+		// it in CONNECT yet; set it anyway so it works once the driver
+		// catches up
+		opts.SetWill(topicStatus, "offline", 0, config.StatusRetain)
+		// also ignored by v0.17, which always asks for 60 seconds and never
+		// pings; loop() keeps the link busy itself, see keepAlive
+		opts.KeepAlive = int64(keepAlive / time.Second)
+
+		if config.Simulate {
+			cl = &simClient{}
+		} else {
+			cl = mqtt.NewClient(opts)
+		}
+		// loop() adds the connection lost handler
+		pub = newPublisher(cl, qos, config.Retain, publishLimit, nil)
+	}
+
+	err := connectBroker(display)
+	if err != nil && config.SecondaryBroker != "" && !onSecondary() {
+		logError(err.Error())
+		useBroker(config.SecondaryBroker, display)
+		err = connectBroker(display)
+	}
+	if err != nil {
+		return err
+	}
+	publishStatus("online")
+	publishInfo()
 
-	lcd.Configure(hd44780i2c.Config{
-		Width:       16, // required
-		Height:      2,  // required
+	return attempt("MQTT subscribe failed", func() error {
+		return subscribe(cl, subHandler)
+	})
+}
+
+// connect cl to the active broker, retrying up to config.MaxAttempts times
+func connectBroker(display func(msg string)) error {
+	logInfo("Connecting to MQTT broker at " + server)
+	display("Connect MQTT broker...")
+	setLED(ledConnectingMQTT)
+	tries := 0
+	return attempt("MQTT connect failed", func() error {
+		tries++
+		if tries > 1 {
+			display("MQTT try " + strconv.Itoa(tries) + "/" + strconv.Itoa(config.MaxAttempts))
+		}
+		token := cl.Connect()
+		if token.Wait() && token.Error() != nil {
+			if strings.HasPrefix(server, "ssl://") {
+				display("TLS connect failed")
+			} else {
+				display("MQTT connect failed")
+			}
+		}
+		return token.Error()
+	})
+}
+
+// Set up the LCD (or OLED) from config, falling back to serial when none
+// answers, and load the custom glyphs. Returns the display and its I2C
+// address.
+func setupDisplay() (Displayer, uint8) {
+	if config.DisplayType == config.DisplaySSD1306 {
+		lcdWidth = int(config.OLEDWidth) / oledCellWidth
+		lcdHeight = int(config.OLEDHeight) / oledCellHeight
+	} else if err := checkLCDGeometry(); err != nil {
+		failMessage(err.Error())
+	}
+	var lcdAddr uint8
+	if !config.Simulate {
+		// the LCD shares the board's supply and ignores I2C until it has
+		// come up, so a cold boot that probes at once finds no display.
+		// A reset leaves it powered.
+		if !woke {
+			time.Sleep(config.BootDelay)
+		}
+		setupI2C()
+		if config.DisplayType == config.DisplaySSD1306 {
+			lcdAddr = config.OLEDAddress
+		} else {
+			lcdAddr = findLCDAddress(i2cBus, config.LCDAddress)
+		}
+	}
+	var lcd Displayer
+	switch {
+	case config.Simulate:
+		lcd = newSerialDisplay()
+	case !i2cPresent(i2cBus, lcdAddr):
+		// headless node: keep going with the display on serial
+		logInfo("LCD not found, serial only")
+		lcd = newSerialDisplay()
+	default:
+		lcd = &guardedDisplay{Displayer: bindDisplay(lcdAddr), addr: lcdAddr}
+	}
+	loadGlyphs(lcd)
+	if config.LCDTest {
+		lcdTest(lcd)
+	}
+	return lcd, lcdAddr
+}
+
+// set up the configured kind of I2C display at addr
+func bindDisplay(addr uint8) Displayer {
+	if config.DisplayType == config.DisplaySSD1306 {
+		dev := ssd1306.NewI2C(&displayBus)
+		dev.Configure(ssd1306.Config{
+			Width:   config.OLEDWidth,
+			Height:  config.OLEDHeight,
+			Address: uint16(addr),
+		})
+		return &ssd1306Display{dev: &dev}
+	}
+	dev := hd44780i2c.New(&displayBus, addr)
+	dev.Configure(hd44780i2c.Config{
+		Width:       uint8(lcdWidth + 1), // the driver breaks lines one column early
+		Height:      uint8(lcdHeight),
 		CursorOn:    false,
 		CursorBlink: false,
 	})
+	return hd44780Display{dev: &dev}
+}
 
-	time.Sleep(3000 * time.Millisecond)
+// Join WiFi, listing the networks in range first with config.ScanOnBoot,
+// then sync the clock. Only a failed join is an error.
+func connectNetwork(display func(msg string)) error {
+	if config.ScanOnBoot {
+		scanNetworks(display)
+	}
+	if err := setupWiFi(display); err != nil {
+		return err
+	}
+	if err := syncTime(); err != nil {
+		logError("NTP: " + err.Error())
+		display("NTP failed")
+	}
+	return nil
+}
 
-	rand.Seed(time.Now().UnixNano())
+func main() {
+	bootTime = time.Now()
+	setupConsole()
+	woke = config.DeepSleep && resetByFirmware()
+	// checked before touching the hardware, reported once the LCD is up
+	cfgErr := config.Validate()
+
+	var lcd Displayer
+	var lcdAddr uint8
+	if !config.NetworkFirst {
+		lcd, lcdAddr = setupDisplay()
+	}
 
-	// Configure SPI for 8Mhz, Mode 0, MSB First
-	spi.Configure(machine.SPIConfig{
-		Frequency: 8 * 1e6,
-		SDO:       machine.NINA_SDO,
-		SDI:       machine.NINA_SDI,
-		SCK:       machine.NINA_SCK,
-	})
+	startWatchdog()
+	if config.LEDPin != machine.NoPin {
+		go runLED(config.LEDPin)
+	}
+	rand.Seed(entropySeed())
+
+	if !config.Simulate {
+		// Configure SPI for 8Mhz, Mode 0, MSB First
+		spi.Configure(machine.SPIConfig{
+			Frequency: 8 * 1e6,
+			SDO:       machine.NINA_SDO,
+			SDI:       machine.NINA_SDI,
+			SCK:       machine.NINA_SCK,
+		})
+
+		// Init esp8266/esp32
+		adaptor = wifinina.New(spi,
+			machine.NINA_CS,
+			machine.NINA_ACK,
+			machine.NINA_GPIO0,
+			machine.NINA_RESETN)
+		adaptor.Configure()
+	}
+	setupTopics()
+
+	networkUp := false
+	if config.NetworkFirst && cfgErr == nil && !config.Simulate {
+		// no LCD yet, so progress only goes to the log and the LED
+		err := connectNetwork(func(msg string) { logInfo(msg) })
+		if err != nil {
+			// bring the LCD up after all so it can say what went wrong
+			lcd, _ = setupDisplay()
+			lcdDisp(lcd, "WiFi failed")
+			failMessage(err.Error())
+		}
+		networkUp = true
+	}
+	if lcd == nil {
+		lcd, lcdAddr = setupDisplay()
+	}
 
-	// Init esp8266/esp32
-	adaptor = wifinina.New(spi,
-		machine.NINA_CS,
-		machine.NINA_ACK,
-		machine.NINA_GPIO0,
-		machine.NINA_RESETN)
-	adaptor.Configure()
+	display := mLcdDisp(lcd)
+	if cfgErr != nil {
+		// before anything else can fail because of it; resetting would
+		// only fail the same way again
+		display(cfgErr.Error())
+		setLED(ledFatal)
+		halt("config: " + cfgErr.Error())
+	}
+	showSplash(display)
+	if !config.Simulate {
+		checkNINAFirmware(display)
+	}
+	setupBattery()
+	if err := setupSensor(lcdAddr); err != nil {
+		display("sensor failed")
+		failMessage(err.Error())
+	}
+	if !config.Simulate {
+		setupProbes()
+	}
+	if config.SelfTest && !config.Simulate {
+		selfTest(bootChecks(lcdAddr), display)
+	}
 
-	display := mLcdDisp(&lcd)
-	display("connect to AP...")
-	connectToAP()
-	display("connected AP")
+	if !config.Simulate && !networkUp {
+		if err := connectNetwork(display); err != nil {
+			failMessage(err.Error())
+		}
+	}
 
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(server).SetClientID("tinygo-client-" + randomString(10))
+	subHandler = getSubHandler(lcd)
+	if err := setupMQTT(display); err != nil {
+		display("MQTT down")
+		resetMessage(err.Error())
+	}
+	subChecked := checkSubscribed(display)
 
-	println("Connecting to MQTT broker at", server)
-	display("Connect MQTT broker...")
-	cl = mqtt.NewClient(opts)
-	if token := cl.Connect(); token.Wait() && token.Error() != nil {
-		failMessage(token.Error().Error())
+	if publishInterval <= 0 {
+		publishInterval = 1 * time.Second
+	}
+	if wifiPollInterval <= 0 {
+		wifiPollInterval = 10 * time.Second
 	}
 
-	subHander := getSubHandler(&lcd)
-	// subscribe
-	token := cl.Subscribe(topicRx, 0, subHander)
-	token.Wait()
-	if token.Error() != nil {
-		failMessage(token.Error().Error())
+	setupButtons(lcd)
+	goSafe("screensaver", func() { runScreensaver(lcd) })
+	goSafe("light sensor", func() { runLightSensor(lcd) })
+	goSafe("PIR", func() { runPIR(lcd) })
+
+	if config.ShowClock {
+		if config.Rotate {
+			goSafe("clock", func() {
+				runClock(func(msg string) {
+					rotation.set(itemClock, msg)
+				})
+			})
+		} else {
+			goSafe("clock", func() { runClock(mLcdStatusCentered(lcd)) })
+		}
+	}
+	if config.Rotate {
+		goSafe("rotation", func() { runRotation(display, config.RotateInterval) })
 	}
 
-	display("Subscribe...")
-	go loop()
+	if !subChecked {
+		display("Subscribe...")
+	}
+	setLED(ledConnected)
+	loop(cl, topicTx, publishInterval, display, mLcdStatus(lcd), mLcdAlert(lcd), getConnectionLostHandler(subHandler, display))
+
+	// the shutdown button was pressed or a reboot was requested
+	if rebootRequested {
+		display("rebooting")
+	} else {
+		display("shutting down")
+	}
+	publishStatus("offline")
+	logInfo("Disconnecting MQTT...")
+	cl.Disconnect(100)
+
+	if rebootRequested {
+		logInfo("Rebooting.")
+		time.Sleep(500 * time.Millisecond)
+		machine.CPUReset()
+	}
+	logInfo("Done.")
+	display("Done.")
+}
 
-	select {}
+// publish a sensor reading to topic every interval until shutdown is closed,
+// reconnecting WiFi and MQTT when the access point goes away. alert shows
+// threshold alerts.
+func loop(cl mqtt.Client, topic string, interval time.Duration, display, status, alert func(msg string), onLost func(client mqtt.Client, err error)) {
+	pub.onLost = onLost
+	lastPoll := time.Now()
+	lastSent := time.Now()
+	var lastBeat time.Time
+	lastStats := time.Now()
+	lastInfo := time.Now()
+	var lastRSSI time.Time
+	for reads := 0; ; {
+		if (config.Rotate || !config.ShowClock) && time.Since(lastRSSI) >= rssiInterval {
+			lastRSSI = time.Now()
+			if config.Rotate {
+				rotation.set(itemRSSI, "RSSI "+rssiText())
+			} else {
+				status("RSSI " + rssiText())
+			}
+		}
+
+		if !config.Simulate && time.Since(lastPoll) >= wifiPollInterval {
+			lastPoll = time.Now()
+			st, err := adaptor.GetConnectionStatus()
+			ninaCheck(err, display)
+			if err == nil && st != wifinina.StatusConnected {
+				logInfo("Connection status: " + st.String())
+				display("reconnecting WiFi")
+				setLED(ledConnectingAP)
+				if err := connectToAP(display); err != nil {
+					// try again at the next poll
+					if !wait(interval) {
+						return
+					}
+					continue
+				}
+				display("connected AP")
+				if err := syncTime(); err != nil {
+					logError("NTP: " + err.Error())
+				}
+				pub.Reconnect(errors.New("WiFi reconnected"))
+			}
+			if err == nil && config.NetSuffix != "" {
+				publishNetIfChanged()
+			}
+		}
+
+		if pollingPaused() {
+			if config.Rotate {
+				rotation.set(itemSensor, "paused")
+			} else {
+				display("paused")
+			}
+			// not a stall, however long it lasts
+			pub.lastOK = time.Now()
+		} else if r, err := sample(); err == nil {
+			t, tu := tempIn(r.temp)
+			text := fmt.Sprintf("T:%.1f%s H:%.0f%%", t, tu, r.hum)
+			if r.pres > 0 && config.CycleValues && reads%2 == 1 {
+				p, pu, prec := presIn(r.pres)
+				text = fmt.Sprintf("P:%.*f%s", prec, p, pu)
+			}
+			if config.Rotate {
+				rotation.set(itemSensor, text)
+			} else {
+				display(text)
+			}
+
+			reads++
+			switch pub.SendString(topic, encodePayload(r)) {
+			case sendSent:
+				lastSent = time.Now()
+				if firstPublish == 0 {
+					notePublished()
+					publishInfo()
+					status("1st pub " + strconv.FormatFloat(firstPublish.Seconds(), 'f', 1, 64) + "s")
+				}
+			case sendBuffered:
+				display("publish failed")
+			}
+
+			if config.Alerts {
+				if a := checkAlert(r.temp); a != "" {
+					logInfo("alert " + a)
+					publishAlert(a, r.temp)
+					rotation.hold(alertHold)
+					alert(fmt.Sprintf("%s T:%.1f%s", a, t, tu))
+				}
+			}
+
+			if batteryLow(r.bat) {
+				logError("battery low")
+				rotation.hold(alertHold)
+				alert(fmt.Sprintf("battery low %.2fV", r.bat))
+			}
+		}
+
+		if !pollingPaused() {
+			pollProbes(pub, func(msg string) {
+				if config.Rotate {
+					rotation.set(itemProbe, msg)
+				} else {
+					status(msg)
+				}
+			})
+		}
+
+		// checked once per interval, since only this goroutine may talk to
+		// the NINA; a heartbeat interval shorter than that has no effect
+		if heartbeatDue(lastBeat) {
+			lastBeat = time.Now()
+			if h := publishHeartbeat(); heapLow(h) {
+				logError("low memory: " + strconv.FormatUint(h.free, 10) + " bytes free")
+				rotation.hold(alertHold)
+				alert("low mem " + strconv.FormatUint(h.free/1024, 10) + "kB")
+			}
+			lastSent = lastBeat
+		}
+		if statsDue(lastStats) {
+			lastStats = time.Now()
+			publishStats()
+			lastSent = lastStats
+		}
+		if infoDue(lastInfo) {
+			lastInfo = time.Now()
+			publishInfo()
+			lastSent = lastInfo
+		}
+		if config.Rotate && config.StatsOnLCD {
+			rotation.set(itemStats, counters.text())
+		}
+
+		if failbackDue() {
+			pub.Reconnect(errFailback)
+		}
+
+		// the hardware watchdog only sees the MCU hang, not a pipeline
+		// that keeps running without getting anything out
+		if pub.Stalled(time.Duration(config.StallPublishes) * interval) {
+			logError("nothing published for " + strconv.Itoa(config.StallPublishes) + " intervals")
+			if config.StallReboot {
+				rebootRequested = true
+				return
+			}
+			display("publish stalled")
+			pub.lastOK = time.Now()
+		}
+
+		if keepAlive > 0 && time.Since(lastSent) >= keepAlive/2 {
+			// nothing went out for a while, send something before the
+			// broker decides the link is stale
+			logDebug("MQTT keep-alive")
+			// a failed publish has the Publisher reconnect
+			if publishStatus("online") != sendSent {
+				display("MQTT ping failed")
+			}
+			lastSent = time.Now()
+		}
+
+		if config.DeepSleep {
+			deepSleep(cl, interval)
+			return
+		}
+		if !wait(interval) {
+			return
+		}
+	}
+}
 
-	// Right now this code is never reached. Need a way to trigger it...
-	println("Disconnecting MQTT...")
+// Drop the MQTT and WiFi connections for d, then reset the board so the
+// next reading comes from a fresh boot. TinyGo has no deep sleep for the
+// SAMD21 yet, but time.Sleep idles the core between ticks so with the
+// radio off the board draws very little. Reconnecting in-process instead
+// would leak the goroutines every Connect of the v0.17.1 mqtt client
+// starts, which Disconnect leaves running, and run out of RAM within
+// hours. Returns only if shutdown was closed while asleep.
+func deepSleep(cl mqtt.Client, d time.Duration) {
 	cl.Disconnect(100)
+	if !config.Simulate {
+		adaptor.Disconnect()
+	}
+	if !wait(d) {
+		return
+	}
+	logInfo("waking up")
+	machine.CPUReset()
+}
 
-	println("Done.")
+// Report whether the last reset was asked for by the firmware, as
+// deepSleep does on waking, rather than made by power-on, the reset
+// button or the watchdog. resetMessage and the like reset the same way,
+// so with config.DeepSleep on it can't tell those apart from a wake.
+func resetByFirmware() bool {
+	return sam.PM.RCAUSE.HasBits(sam.PM_RCAUSE_SYST)
 }
 
-func loop() {
-	for i := 0; ; i++ {
-		//println("...")
-		//display("Subscribe...")
-		time.Sleep(3000 * time.Millisecond)
+// wait for d while feeding the watchdog, reporting false if shutdown was
+// closed meanwhile. A publish button press ends the wait early.
+func wait(d time.Duration) bool {
+	for d > 0 {
+		step := d
+		if step > time.Second {
+			step = time.Second
+		}
+		select {
+		case <-shutdown:
+			return false
+		case <-publishNow:
+			return true
+		case <-time.After(step):
+		}
+		feedWatchdog()
+		d -= step
 	}
+	return true
 }
 
-// connect to access point
-func connectToAP() {
-	time.Sleep(2 * time.Second)
-	println("Connecting to " + ssid)
-	adaptor.SetPassphrase(ssid, pass)
-	for st, _ := adaptor.GetConnectionStatus(); st != wifinina.StatusConnected; {
-		println("Connection status: " + st.String())
-		time.Sleep(1 * time.Second)
-		st, _ = adaptor.GetConnectionStatus()
+// publish the presence status ("online" or "offline") of this node
+func publishStatus(status string) sendResult {
+	return pub.SendWith(topicStatus, []byte(status), 0, config.StatusRetain)
+}
+
+// encode a reading as compact JSON like {"t":23.4,"tu":"C","h":55} in the
+// configured units, with "p" (and its unit "pu") and "bat" set to the
+// pressure and battery voltage when there are any and "ts" set to the ISO
+// 8601 time once NTP has synced. The Publisher adds "seq" and "ms".
+// Built by hand since encoding/json is only partly supported by TinyGo.
+func encodePayload(r Reading) string {
+	t, tu := tempIn(r.temp)
+	payload := `{"t":` + strconv.FormatFloat(float64(t), 'f', -1, 32) + `,"tu":"` + tu + `"` +
+		`,"h":` + strconv.FormatFloat(float64(r.hum), 'f', -1, 32)
+	if r.pres > 0 {
+		p, pu, prec := presIn(r.pres)
+		payload += `,"p":` + strconv.FormatFloat(float64(p), 'f', prec, 32) + `,"pu":"` + pu + `"`
 	}
-	println("Connected.")
-	time.Sleep(2 * time.Second)
-	ip, _, _, err := adaptor.GetIP()
-	for ; err != nil; ip, _, _, err = adaptor.GetIP() {
-		println(err.Error())
-		time.Sleep(1 * time.Second)
+	if r.bat > 0 {
+		payload += `,"bat":` + strconv.FormatFloat(float64(r.bat), 'f', 2, 32)
+	}
+	if clockSynced {
+		payload += `,"ts":"` + now().UTC().Format(time.RFC3339) + `"`
+	}
+	return payload + `}`
+}
+
+// MQTT client ID that stays the same across reboots so the broker can keep
+// the session, falling back to a random one without a MAC address
+func clientID() string {
+	if id := deviceID(); id != "" {
+		return "belltomo-" + id
 	}
-	println(ip.String())
+	logError("can't read MAC address, using a random client ID")
+	return "tinygo-client-" + randomString(10)
 }
 
 // Returns an int >= min, < max
@@ -181,18 +839,78 @@ func randomInt(min, max int) int {
 	return min + rand.Intn(max-min)
 }
 
-// Generate a random string of A-Z chars with len = l
+// characters randomString picks from
+const randomAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Generate a random string of randomAlphabet chars with len = l
 func randomString(len int) string {
 	bytes := make([]byte, len)
 	for i := 0; i < len; i++ {
-		bytes[i] = byte(randomInt(65, 90))
+		bytes[i] = randomAlphabet[randomInt(0, 62)]
 	}
 	return string(bytes)
 }
 
+// The clock starts at the same value on every boot, so mix in the noise
+// of a floating ADC pin to get a seed that differs between boots.
+func entropySeed() int64 {
+	machine.InitADC()
+	adc := machine.ADC{Pin: config.EntropyPin}
+	adc.Configure(machine.ADCConfig{})
+
+	seed := time.Now().UnixNano()
+	for i := 0; i < 64; i++ {
+		// FNV-1a style mix; every bit of the sample counts
+		seed = (seed ^ int64(adc.Get())) * 1099511628211
+		time.Sleep(100 * time.Microsecond)
+	}
+	return seed
+}
+
+// run op until it succeeds, backing off between attempts, returning msg
+// with the last error after config.MaxAttempts failures
+func attempt(msg string, op func() error) error {
+	b := NewBackoff(1*time.Second, 30*time.Second)
+	for i := 1; ; i++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		logError(msg + " (attempt " + strconv.Itoa(i) + "): " + err.Error())
+		if i >= config.MaxAttempts {
+			return errors.New(msg + ": " + err.Error())
+		}
+
+		pause(b.Next())
+	}
+}
+
+// report an unrecoverable error, then reset the board so it starts fresh,
+// or halt printing msg if config.ResetOnFailure is off
 func failMessage(msg string) {
-	for {
-		println(msg)
+	setLED(ledFatal)
+	if config.ResetOnFailure {
+		logError(msg + ", resetting")
 		time.Sleep(1 * time.Second)
+		machine.CPUReset()
+	}
+	halt(msg)
+}
+
+// Report an error that a fresh start is likely to get past, such as a
+// broker that was briefly down, and reset the board even without
+// config.ResetOnFailure rather than halting for good.
+func resetMessage(msg string) {
+	setLED(ledFatal)
+	logError(msg + ", resetting")
+	time.Sleep(1 * time.Second)
+	machine.CPUReset()
+}
+
+// stop here for good, printing msg every second
+func halt(msg string) {
+	for {
+		logError(msg)
+		pause(1 * time.Second)
 	}
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRandomString(t *testing.T) {
+	rand.Seed(1)
+	for _, n := range []int{0, 1, 8, 23, 500} {
+		s := randomString(n)
+		if len(s) != n {
+			t.Errorf("len(randomString(%d)) = %d", n, len(s))
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(randomAlphabet, c) {
+				t.Errorf("randomString(%d) has %q, not in randomAlphabet", n, c)
+			}
+		}
+	}
+}
+
+func TestRandomStringUsesWholeAlphabet(t *testing.T) {
+	rand.Seed(1)
+	s := randomString(5000)
+	for _, c := range randomAlphabet {
+		if !strings.ContainsRune(s, c) {
+			t.Errorf("%q never picked in 5000 characters", c)
+		}
+	}
+}
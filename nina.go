@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oldest NINA firmware known to work with the wifinina driver; older ones
+// answer some calls with nothing, which shows up as odd connect failures
+const minNINAFirmware = "1.4.5"
+
+// consecutive failed NINA calls before the coprocessor is re-initialized,
+// and re-inits in a row before giving up and resetting the board
+const (
+	maxNINAErrors = 3
+	maxNINAResets = 2
+)
+
+var (
+	ninaErrors int
+	ninaResets int
+)
+
+// Record the outcome of a NINA call. An SPI hiccup now and then is
+// harmless, but after maxNINAErrors failures in a row the coprocessor is
+// reset and configured again, and when that keeps happening the board
+// resets through failMessage.
+func ninaCheck(err error, display func(msg string)) {
+	if err == nil {
+		ninaErrors = 0
+		ninaResets = 0
+		return
+	}
+	ninaErrors++
+	logError("NINA: " + err.Error())
+	if ninaErrors < maxNINAErrors {
+		return
+	}
+
+	display("NINA error")
+	ninaErrors = 0
+	ninaResets++
+	if ninaResets > maxNINAResets {
+		failMessage("NINA not responding")
+	}
+	logInfo("Re-initializing NINA")
+	adaptor.Configure()
+}
+
+// Log the NINA firmware version and warn on the LCD for a couple of
+// seconds if it is older than minNINAFirmware. Skipped without
+// config.CheckFirmware.
+func checkNINAFirmware(display func(msg string)) {
+	if !config.CheckFirmware {
+		return
+	}
+	fw, err := adaptor.GetFwVersion()
+	if err != nil {
+		logError("NINA firmware version: " + err.Error())
+		return
+	}
+	logInfo("NINA firmware " + fw)
+	if versionLess(fw, minNINAFirmware) {
+		logError("NINA firmware " + fw + " is older than " + minNINAFirmware + ", please update it")
+		display("NINA fw " + fw + "\nplease update")
+		pause(2 * time.Second)
+	}
+}
+
+// whether dotted version a (like "1.4.5") is older than b. Missing or
+// non-numeric parts count as 0.
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.TrimSpace(as[i]))
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.TrimSpace(bs[i]))
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
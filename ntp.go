@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/amanoese/belltomo/config"
+	"time"
+	"tinygo.org/x/drivers/net"
+)
+
+const ntpPacketSize = 48
+
+// seconds from the NTP epoch (1900) to the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+var (
+	// difference between wall-clock time and the board clock
+	clockOffset time.Duration
+	clockSynced bool
+
+	// wall-clock time of boot, known once synced, to line up the "ms" of
+	// published messages with real time
+	bootEpoch time.Time
+)
+
+// ask config.NTPServer for the time and remember how far the board clock is
+// off. This takes the NINA's only socket, so call it before MQTT connects.
+func syncTime() error {
+	raddr, err := net.ResolveUDPAddr("udp", config.NTPServer+":123")
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", &net.UDPAddr{Port: 2390}, raddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var b [ntpPacketSize]byte
+	b[0] = 0x1B // leap 0, version 3, mode 3 (client)
+	if _, err := conn.Write(b[:]); err != nil {
+		return err
+	}
+
+	for sent := time.Now(); time.Since(sent) < 2*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		n, err := conn.Read(b[:])
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if n < ntpPacketSize {
+			return errors.New("short NTP reply")
+		}
+
+		// transmit timestamp, whole seconds
+		secs := binary.BigEndian.Uint32(b[40:44])
+		clockOffset = time.Unix(int64(secs)-ntpEpochOffset, 0).Sub(time.Now())
+		clockSynced = true
+		bootEpoch = bootTime.Add(clockOffset)
+		return nil
+	}
+	return errors.New("no NTP reply")
+}
+
+// wall-clock time once syncTime has succeeded, time since boot before that
+func now() time.Time {
+	return time.Now().Add(clockOffset)
+}
+
+// show the time as HH:MM:SS (UTC) on the bottom LCD row every second
+func runClock(status func(msg string)) {
+	for {
+		status(now().UTC().Format("15:04:05"))
+		time.Sleep(time.Second)
+	}
+}
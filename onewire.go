@@ -0,0 +1,176 @@
+package main
+
+import (
+	"machine"
+	"runtime/volatile"
+)
+
+// oneWire bit-bangs a Dallas/Maxim 1-Wire bus on pin, which needs a 4.7k
+// pull-up to 3.3V. Timing comes from busy loops, so a long interrupt (USB)
+// in the middle of a slot can corrupt a bit; the CRCs catch that.
+type oneWire struct {
+	pin machine.Pin
+}
+
+// 1-Wire ROM commands
+const (
+	owSearchROM = 0xF0
+	owMatchROM  = 0x55
+	owSkipROM   = 0xCC
+)
+
+var (
+	// busy loop iterations per microsecond; each takes about 4 cycles
+	spinsPerMicro = machine.CPUFrequency() / 4000000
+
+	// read in the busy loop so the compiler can't drop it
+	spin volatile.Register32
+)
+
+// wait about us microseconds without yielding to the scheduler
+func delayMicros(us uint32) {
+	for n := us * spinsPerMicro; n > 0; n-- {
+		spin.Get()
+	}
+}
+
+func (w *oneWire) low() {
+	w.pin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	w.pin.Low()
+}
+
+func (w *oneWire) release() {
+	w.pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+}
+
+// reset the bus, reporting whether any device answered with a presence
+// pulse
+func (w *oneWire) reset() bool {
+	w.low()
+	delayMicros(480)
+	w.release()
+	delayMicros(70)
+	present := !w.pin.Get()
+	delayMicros(410)
+	return present
+}
+
+func (w *oneWire) writeBit(b bool) {
+	w.low()
+	if b {
+		delayMicros(6)
+		w.release()
+		delayMicros(64)
+	} else {
+		delayMicros(60)
+		w.release()
+		delayMicros(10)
+	}
+}
+
+func (w *oneWire) readBit() bool {
+	w.low()
+	delayMicros(6)
+	w.release()
+	delayMicros(9)
+	b := w.pin.Get()
+	delayMicros(55)
+	return b
+}
+
+// write b, least significant bit first
+func (w *oneWire) writeByte(b byte) {
+	for i := 0; i < 8; i++ {
+		w.writeBit(b&(1<<i) != 0)
+	}
+}
+
+// read a byte, least significant bit first
+func (w *oneWire) readByte() byte {
+	var b byte
+	for i := 0; i < 8; i++ {
+		if w.readBit() {
+			b |= 1 << i
+		}
+	}
+	return b
+}
+
+// reset the bus and address the device with rom
+func (w *oneWire) selectROM(rom [8]byte) bool {
+	if !w.reset() {
+		return false
+	}
+	w.writeByte(owMatchROM)
+	for _, b := range rom {
+		w.writeByte(b)
+	}
+	return true
+}
+
+// Find the ROM IDs of up to max devices on the bus with the Search ROM
+// algorithm of Maxim application note 187. IDs with a bad CRC are skipped.
+func (w *oneWire) search(max int) [][8]byte {
+	var ids [][8]byte
+	var rom [8]byte
+	last := -1 // bit where the previous pass last went the 0 way
+	for len(ids) < max {
+		if !w.reset() {
+			return ids
+		}
+		w.writeByte(owSearchROM)
+		zero := -1
+		for i := 0; i < 64; i++ {
+			b, cb := w.readBit(), w.readBit()
+			var dir bool
+			switch {
+			case b && cb:
+				// nobody answered
+				return ids
+			case b != cb:
+				// every remaining device has the same bit here
+				dir = b
+			case i < last:
+				dir = rom[i/8]&(1<<(i%8)) != 0
+			default:
+				dir = i == last
+			}
+			if !b && !cb && !dir {
+				zero = i
+			}
+			if dir {
+				rom[i/8] |= 1 << (i % 8)
+			} else {
+				rom[i/8] &^= 1 << (i % 8)
+			}
+			w.writeBit(dir)
+		}
+		if crc8Maxim(rom[:7]) == rom[7] {
+			ids = append(ids, rom)
+		} else {
+			logError("1-Wire ROM CRC mismatch")
+		}
+		if zero < 0 {
+			return ids
+		}
+		last = zero
+	}
+	return ids
+}
+
+// Dallas/Maxim CRC-8 (polynomial x^8+x^5+x^4+1, reflected) of data, over
+// ROM IDs and scratchpads
+func crc8Maxim(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 1
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8C
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
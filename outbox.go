@@ -0,0 +1,51 @@
+package main
+
+import "strconv"
+
+// number of payloads kept while the broker is unreachable
+const outboxSize = 32
+
+// a payload waiting to go to topic
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+}
+
+// outbox is a fixed-size ring buffer of messages that failed to publish.
+// When it is full the oldest one is dropped to make room.
+type outbox struct {
+	buf     [outboxSize]message
+	head    int // index of the oldest payload
+	n       int
+	dropped int
+}
+
+// add m to the end of the buffer, dropping the oldest if full
+func (o *outbox) push(m message) {
+	if o.n == len(o.buf) {
+		o.pop()
+		o.dropped++
+		logError("outbox full, dropped " + strconv.Itoa(o.dropped) + " messages")
+	}
+	o.buf[(o.head+o.n)%len(o.buf)] = m
+	o.n++
+}
+
+// oldest message in the buffer
+func (o *outbox) peek() message {
+	return o.buf[o.head]
+}
+
+// remove the oldest message
+func (o *outbox) pop() {
+	o.buf[o.head] = message{}
+	o.head = (o.head + 1) % len(o.buf)
+	o.n--
+}
+
+// number of messages waiting to be published
+func (o *outbox) depth() int {
+	return o.n
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+	"tinygo.org/x/drivers/net/mqtt"
+)
+
+// fakeClient records what is published, failing while fail is set
+type fakeClient struct {
+	simClient
+	fail error
+	sent []message
+}
+
+// fakeToken is a finished token ending in err
+type fakeToken struct{ err error }
+
+func (fakeToken) Wait() bool                     { return true }
+func (fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t fakeToken) Error() error                 { return t.err }
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if c.fail != nil {
+		return fakeToken{c.fail}
+	}
+	c.sent = append(c.sent, message{topic: topic, payload: payload.([]byte), qos: qos, retain: retained})
+	return fakeToken{}
+}
+
+// a Publisher on cl with no rate limit and no reconnecting
+func newTestPublisher(cl mqtt.Client) *Publisher {
+	return newPublisher(cl, 1, false, newLimiter(0, 1, time.Now), nil)
+}
+
+func TestOutboxFlushesInOrder(t *testing.T) {
+	cl := &fakeClient{}
+	p := newTestPublisher(cl)
+	for i := 0; i < 5; i++ {
+		if got := p.SendString("t", strconv.Itoa(i)); got != sendBuffered {
+			t.Fatalf("Send while disconnected = %v, want sendBuffered", got)
+		}
+	}
+	if p.Depth() != 5 || len(cl.sent) != 0 {
+		t.Fatalf("depth %d, sent %d, want 5 queued and none sent", p.Depth(), len(cl.sent))
+	}
+
+	cl.connected = true
+	p.Flush()
+	if p.Depth() != 0 || len(cl.sent) != 5 {
+		t.Fatalf("depth %d, sent %d after Flush, want all 5 sent", p.Depth(), len(cl.sent))
+	}
+	for i, m := range cl.sent {
+		if string(m.payload) != strconv.Itoa(i) || m.qos != 1 {
+			t.Errorf("message %d = %q at qos %d, want %q at qos 1", i, m.payload, m.qos, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestOutboxFlushStopsAtFailure(t *testing.T) {
+	cl := &fakeClient{}
+	p := newTestPublisher(cl)
+	p.SendString("t", "a")
+	p.SendString("t", "b")
+
+	cl.connected = true
+	cl.fail = errors.New("broken pipe")
+	p.Flush()
+	if p.Depth() != 2 {
+		t.Fatalf("depth %d after a failed Flush, want 2", p.Depth())
+	}
+
+	// a failed Send queues behind what is already waiting
+	if got := p.SendString("t", "c"); got != sendBuffered {
+		t.Fatalf("failed Send = %v, want sendBuffered", got)
+	}
+	cl.fail = nil
+	p.Flush()
+	var got string
+	for _, m := range cl.sent {
+		got += string(m.payload)
+	}
+	if got != "abc" {
+		t.Errorf("sent %q, want \"abc\"", got)
+	}
+}
+
+func TestOutboxOverflowDropsOldest(t *testing.T) {
+	cl := &fakeClient{}
+	p := newTestPublisher(cl)
+	extra := 3
+	for i := 0; i < outboxSize+extra; i++ {
+		p.SendString("t", strconv.Itoa(i))
+	}
+	if p.Depth() != outboxSize || p.Dropped() != extra {
+		t.Fatalf("depth %d, dropped %d, want %d and %d", p.Depth(), p.Dropped(), outboxSize, extra)
+	}
+
+	cl.connected = true
+	p.Flush()
+	if len(cl.sent) != outboxSize {
+		t.Fatalf("sent %d, want %d", len(cl.sent), outboxSize)
+	}
+	for i, m := range cl.sent {
+		if want := strconv.Itoa(i + extra); string(m.payload) != want {
+			t.Errorf("message %d = %q, want %q", i, m.payload, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"runtime/volatile"
+	"time"
+)
+
+// motion closer together than this is handled once, so a jittery sensor
+// can't keep the I2C bus busy
+const pirHoldoff = time.Second
+
+var (
+	// when config.PIRPin last saw someone; lcdMu guards it
+	lastMotion = time.Now()
+
+	// set from the PIR interrupt, cleared by runPIR
+	motionSeen volatile.Register8
+)
+
+// report whether someone is about, going by the PIR sensor: always true
+// without one, otherwise until config.PIRTimeout after the last motion.
+// lcdMu must be held.
+func present() bool {
+	return config.PIRPin == machine.NoPin || time.Since(lastMotion) < config.PIRTimeout
+}
+
+// Wake the display when the PIR sensor on config.PIRPin sees motion and
+// turn the backlight off once it has seen none for config.PIRTimeout.
+// wake keeps the backlight off while nobody is present, so new messages
+// don't light an empty room, and the light sensor still has the last word
+// on whether it is dark enough to need it.
+func runPIR(lcd Displayer) {
+	if config.PIRPin == machine.NoPin {
+		return
+	}
+	config.PIRPin.Configure(machine.PinConfig{Mode: machine.PinInputPulldown})
+	err := config.PIRPin.SetInterrupt(machine.PinRising, func(machine.Pin) {
+		motionSeen.Set(1)
+	})
+	if err != nil {
+		logError("PIR: " + err.Error())
+		return
+	}
+
+	var handled time.Time
+	for {
+		time.Sleep(debounce)
+
+		// the sensor holds its output high as long as it sees motion
+		if motionSeen.Get() != 0 || config.PIRPin.Get() {
+			motionSeen.Set(0)
+			time.Sleep(debounce)
+			if config.PIRPin.Get() && time.Since(handled) >= pirHoldoff {
+				handled = time.Now()
+				motion(lcd)
+			}
+			continue
+		}
+
+		lcdMu.Lock()
+		if backlightOn && !present() {
+			logDebug("no motion, backlight off")
+			setBacklight(lcd, false)
+		}
+		lcdMu.Unlock()
+	}
+}
+
+// someone came by: bring back the backlight and whatever the screensaver
+// blanked
+func motion(lcd Displayer) {
+	lcdMu.Lock()
+	lastMotion = time.Now()
+	wake(lcd)
+	msg := ""
+	if saverOn {
+		msg = lcdShown
+		lcdShown = ""
+	}
+	lcdMu.Unlock()
+	if msg != "" {
+		lcdDisp(lcd, msg)
+	}
+}
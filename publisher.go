@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strconv"
+	"time"
+	"tinygo.org/x/drivers/net/mqtt"
+)
+
+// what became of a message given to Publisher.Send
+type sendResult int
+
+const (
+	sendSent     sendResult = iota
+	sendBuffered            // kept in the outbox until the next Flush
+	sendDropped             // refused by the rate limit
+)
+
+// Publisher sends messages through an MQTT client, keeping the ones that
+// can't go out now in an outbox and dropping those over the rate limit.
+// When a publish fails it calls onLost, which reconnects, and flushes.
+// Everything the station publishes goes through the one in pub, so the
+// limit, the outbox and the counters cover all of it.
+//
+// Every JSON object it is given gets "seq", counting up from 0 with each
+// Send (dropped messages too, so gaps show), and "ms" since boot, so the
+// messages can be put in order without a synced clock.
+type Publisher struct {
+	cl     mqtt.Client
+	qos    byte
+	retain bool
+	limit  *limiter
+	queue  outbox
+	onLost func(client mqtt.Client, err error)
+	seq    int
+	lastOK time.Time // of the last publish that went through
+
+	// onLost is running; messages failing meanwhile, like the status
+	// published on reconnecting, only wait in the outbox
+	recovering bool
+}
+
+// the Publisher made by setupMQTT along with cl
+var pub *Publisher
+
+func newPublisher(cl mqtt.Client, qos byte, retain bool, limit *limiter, onLost func(client mqtt.Client, err error)) *Publisher {
+	return &Publisher{cl: cl, qos: qos, retain: retain, limit: limit, onLost: onLost, lastOK: time.Now()}
+}
+
+// Send payload to topic at the Publisher's QoS and retain flag, reporting
+// whether it went out, waits in the outbox or was dropped. The payload is
+// sent as is, so it may be binary; only JSON objects are stamped. Send must
+// not be given a slice the caller goes on to modify, as it may wait in the
+// outbox.
+func (p *Publisher) Send(topic string, payload []byte) sendResult {
+	return p.SendWith(topic, payload, p.qos, p.retain)
+}
+
+// Send a text payload to topic
+func (p *Publisher) SendString(topic, payload string) sendResult {
+	return p.Send(topic, []byte(payload))
+}
+
+// Send payload to topic at qos, retained if retain is set
+func (p *Publisher) SendWith(topic string, payload []byte, qos byte, retain bool) sendResult {
+	m := message{topic: topic, payload: stampPayload(payload, p.seq, time.Since(bootTime)), qos: qos, retain: retain}
+	p.seq++
+	if !p.limit.allow() {
+		return sendDropped
+	}
+	if !p.cl.IsConnected() {
+		p.queue.push(m)
+		return sendBuffered
+	}
+	if err := p.publish(m); err != nil {
+		p.queue.push(m)
+		p.Reconnect(err)
+		return sendBuffered
+	}
+	return sendSent
+}
+
+// Have onLost reconnect after err, then flush the outbox. Does nothing
+// while onLost is already running, as the messages it publishes on
+// reconnecting come back here when they fail.
+func (p *Publisher) Reconnect(err error) {
+	if p.onLost == nil || p.recovering {
+		return
+	}
+	p.recovering = true
+	p.onLost(p.cl, err)
+	p.recovering = false
+	p.Flush()
+}
+
+// Publish the buffered messages, oldest first, stopping at the first
+// failure so the rest stay queued.
+func (p *Publisher) Flush() {
+	for p.queue.depth() > 0 {
+		if p.publish(p.queue.peek()) != nil {
+			return
+		}
+		p.queue.pop()
+	}
+}
+
+func (p *Publisher) publish(m message) error {
+	token := p.cl.Publish(m.topic, m.qos, m.retain, m.payload)
+	token.Wait()
+	counters.publish(token.Error())
+	if token.Error() != nil {
+		logError(token.Error().Error())
+		return token.Error()
+	}
+	p.lastOK = time.Now()
+	return nil
+}
+
+// report whether nothing has gone out for as long as after (since
+// creation, if nothing ever did)
+func (p *Publisher) Stalled(after time.Duration) bool {
+	return after > 0 && time.Since(p.lastOK) >= after
+}
+
+// sequence number the next Send will use
+func (p *Publisher) Seq() int {
+	return p.seq
+}
+
+// payload with "seq" and "ms" (since boot) added if it is a JSON object
+func stampPayload(payload []byte, seq int, up time.Duration) []byte {
+	n := len(payload)
+	if n < 2 || payload[0] != '{' || payload[n-1] != '}' {
+		return payload
+	}
+	sep := ","
+	if n == 2 {
+		sep = ""
+	}
+	return []byte(string(payload[:n-1]) + sep + `"seq":` + strconv.Itoa(seq) +
+		`,"ms":` + strconv.FormatInt(up.Milliseconds(), 10) + `}`)
+}
+
+// number of messages in the outbox
+func (p *Publisher) Depth() int {
+	return p.queue.depth()
+}
+
+// number of messages lost to a full outbox or the rate limit
+func (p *Publisher) Dropped() int {
+	return p.queue.dropped + p.limit.dropped
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestStampPayload(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`{"temp":21.5}`, `{"temp":21.5,"seq":7,"ms":1500}`},
+		{`{}`, `{"seq":7,"ms":1500}`},
+		{`online`, `online`}, // not JSON
+		{`[1,2]`, `[1,2]`},   // not an object
+		{`{`, `{`},
+		{``, ``},
+	}
+	for _, tt := range tests {
+		if got := string(stampPayload([]byte(tt.in), 7, 1500*time.Millisecond)); got != tt.want {
+			t.Errorf("stampPayload(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSendStampsSeq(t *testing.T) {
+	cl := &fakeClient{}
+	cl.connected = true
+	now := time.Unix(0, 0)
+	// one message allowed: the second is dropped but still numbered
+	p := newPublisher(cl, 0, false, newLimiter(0.001, 1, func() time.Time { return now }), nil)
+
+	p.SendString("t", `{"n":1}`)
+	if got := p.SendString("t", `{"n":2}`); got != sendDropped {
+		t.Fatalf("second Send = %v, want sendDropped", got)
+	}
+	now = now.Add(time.Hour)
+	p.SendString("t", "plain")
+	now = now.Add(time.Hour)
+	p.SendString("t", `{"n":4}`)
+
+	if len(cl.sent) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(cl.sent))
+	}
+	want := []string{
+		`^\{"n":1,"seq":0,"ms":\d+\}$`,
+		`^plain$`,
+		`^\{"n":4,"seq":3,"ms":\d+\}$`, // seq 1 went with the dropped one
+	}
+	for i, re := range want {
+		if got := string(cl.sent[i].payload); !regexp.MustCompile(re).MatchString(got) {
+			t.Errorf("message %d = %s, want %s", i, got, re)
+		}
+	}
+	if p.Seq() != 4 {
+		t.Errorf("Seq() = %d, want 4", p.Seq())
+	}
+}
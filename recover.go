@@ -0,0 +1,45 @@
+package main
+
+// Panics in the message handler and the goroutines that draw are caught
+// here rather than taking down the whole station, which a malformed
+// payload could otherwise do from afar. Needs a TinyGo whose target
+// supports recover; older ones still abort.
+
+// log r, the value of a recovered panic in where, reporting whether there
+// was one
+func logPanic(where string, r interface{}) bool {
+	if r == nil {
+		return false
+	}
+	if err, ok := r.(error); ok {
+		logError(where + " panic: " + err.Error())
+	} else if s, ok := r.(string); ok {
+		logError(where + " panic: " + s)
+	} else {
+		logError(where + " panic")
+	}
+	return true
+}
+
+// Run f on a goroutine of its own, logging a panic in it instead of
+// letting it end the program. Every goroutine that draws is started this
+// way.
+func goSafe(where string, f func()) {
+	go func() {
+		defer func() {
+			logPanic(where, recover())
+		}()
+		f()
+	}()
+}
+
+// Keep a panic while handling a message on topic from taking down the
+// client's goroutine: log it and show "msg error", from a goroutine since
+// the panic may have left lcdMu held.
+func recoverMessage(lcd Displayer, topic string) {
+	if logPanic("["+topic+"]", recover()) {
+		goSafe("msg error", func() {
+			lcdDisp(lcd, "msg error")
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMessage is an incoming MQTT message
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 0 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+// wait up to a second for row of d to start with want
+func waitForRow(t *testing.T, d *serialDisplay, row int, want string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		lcdMu.Lock()
+		got := rowText(d, row)
+		lcdMu.Unlock()
+		if strings.HasPrefix(got, want) {
+			return
+		}
+	}
+	t.Errorf("row %d never showed %q, has %q", row, want, rowText(d, row))
+}
+
+func TestSubHandlerTooManyLines(t *testing.T) {
+	d := newSerialDisplay()
+	lcdShown = ""
+	handler := getSubHandler(d)
+	// crashed the board when drawn before the marquee fix, and now goes
+	// through the coalescer's goroutine
+	handler(nil, fakeMessage{topic: "tinygo/test/rx", payload: []byte("a\nb\nc")})
+	waitForRow(t, d, 0, "a b c")
+}
+
+func TestSubHandlerRecoversFromPanic(t *testing.T) {
+	d := newSerialDisplay()
+	lcdShown = ""
+	handler := getSubHandler(d)
+	onTopic("tinygo/test/panic", func(payload []byte) {
+		panic("bad payload " + string(payload))
+	})
+	handler(nil, fakeMessage{topic: "tinygo/test/panic", payload: []byte("x")})
+	waitForRow(t, d, 0, "msg error")
+}
+
+func TestGoSafeRecovers(t *testing.T) {
+	done := make(chan struct{})
+	goSafe("test", func() {
+		defer close(done)
+		var s []byte
+		_ = s[3]
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("goroutine never finished")
+	}
+}
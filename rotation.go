@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// items the display rotation cycles through, in order
+const (
+	itemSensor = iota
+	itemClock
+	itemRSSI
+	itemRx
+	itemStats
+	itemProbe
+	itemCount
+)
+
+// names used by the pin:<name> command
+var itemNames = [itemCount]string{"sensor", "clock", "rssi", "rx", "stats", "probe"}
+
+// how long an alert keeps the rotation from drawing over it
+const alertHold = 10 * time.Second
+
+// rotator cycles the LCD through the latest text of each item so sensor
+// readings, the clock and rx messages take turns instead of overwriting
+// each other. Items with no text yet are skipped.
+type rotator struct {
+	mu        sync.Mutex
+	text      [itemCount]string
+	cur       int
+	pinned    int // item shown permanently, -1 while rotating
+	switched  time.Time
+	holdUntil time.Time
+}
+
+var rotation = rotator{pinned: -1}
+
+// update the text of item, shown the next time it comes round
+func (r *rotator) set(item int, text string) {
+	r.mu.Lock()
+	r.text[item] = text
+	r.mu.Unlock()
+}
+
+// switch to item now, restarting its turn
+func (r *rotator) show(item int) {
+	r.mu.Lock()
+	r.cur = item
+	r.switched = time.Now()
+	r.mu.Unlock()
+}
+
+// keep showing the item called name until unpin, reporting whether the
+// name is known
+func (r *rotator) pin(name string) bool {
+	for i, n := range itemNames {
+		if n == name {
+			r.mu.Lock()
+			r.pinned = i
+			r.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// go back to rotating
+func (r *rotator) unpin() {
+	r.mu.Lock()
+	r.pinned = -1
+	r.mu.Unlock()
+}
+
+// move on to the next item at the next draw
+func (r *rotator) skip() {
+	r.mu.Lock()
+	r.switched = time.Time{}
+	r.mu.Unlock()
+}
+
+// leave the display alone for d, so an alert stays readable
+func (r *rotator) hold(d time.Duration) {
+	r.mu.Lock()
+	r.holdUntil = time.Now().Add(d)
+	r.mu.Unlock()
+}
+
+// text to draw at t, moving on to the next item with text once the current
+// one has been up for interval. ok is false when there is nothing to draw.
+func (r *rotator) next(t time.Time, interval time.Duration) (text string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t.Before(r.holdUntil) {
+		return "", false
+	}
+	if r.pinned >= 0 {
+		return r.text[r.pinned], r.text[r.pinned] != ""
+	}
+	if lcdHeight >= itemCount {
+		// a display with a row for every item (like the OLED) shows them
+		// all at once
+		return r.page()
+	}
+	if t.Sub(r.switched) >= interval || r.text[r.cur] == "" {
+		for i := 1; i <= itemCount; i++ {
+			if c := (r.cur + i) % itemCount; r.text[c] != "" {
+				r.cur = c
+				break
+			}
+		}
+		r.switched = t
+	}
+	return r.text[r.cur], r.text[r.cur] != ""
+}
+
+// every item with text on a row of its own, cut to the display width.
+// r.mu must be held.
+func (r *rotator) page() (text string, ok bool) {
+	var lines []string
+	for _, t := range r.text {
+		if t == "" {
+			continue
+		}
+		if len(t) > lcdWidth {
+			t = t[:lcdWidth]
+		}
+		lines = append(lines, t)
+	}
+	return strings.Join(lines, "\n"), len(lines) > 0
+}
+
+// run a rotation command (pin:<name> or unpin), reporting whether msg was one
+func rotationCommand(msg string) bool {
+	switch {
+	case msg == "unpin":
+		rotation.unpin()
+	case strings.HasPrefix(msg, "pin:"):
+		return rotation.pin(strings.TrimPrefix(msg, "pin:"))
+	default:
+		return false
+	}
+	return true
+}
+
+// Draw the rotation every second, so a shown clock keeps ticking; lcdDisp
+// skips redrawing text that didn't change.
+func runRotation(display func(msg string), interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		if text, ok := rotation.next(time.Now(), interval); ok {
+			display(text)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"math/rand"
+	"time"
+)
+
+// how often the screensaver checks for idleness and moves its dot
+const saverStep = 5 * time.Second
+
+var (
+	// the screen is blanked; lcdDisp ends it when something new is shown
+	saverOn bool
+
+	// when lcdDisp or a status last drew something that wasn't already on
+	// screen
+	lastChange = time.Now()
+
+	// the last status drawn on the bottom row
+	statusShown string
+)
+
+// Blank the screen and turn the backlight off once nothing new has been
+// shown for config.ScreensaverTimeout, leaving only a dot that moves every
+// few seconds (with config.ScreensaverMove) so the unit is plainly still
+// running. Repeating the same text, as a steady sensor or a fixed status
+// does, is idle; a ticking clock is not.
+func runScreensaver(lcd Displayer) {
+	if config.ScreensaverTimeout <= 0 {
+		return
+	}
+	var x, y int
+	for {
+		time.Sleep(saverStep)
+
+		lcdMu.Lock()
+		switch {
+		case !saverOn && time.Since(lastChange) >= config.ScreensaverTimeout:
+			logDebug("screensaver on")
+			saverOn = true
+			stopScrolling()
+			lcd.Clear()
+			setBacklight(lcd, false)
+			x, y = 0, 0
+			lcd.Print([]byte{'.'})
+		case saverOn && config.ScreensaverMove:
+			lcd.SetCursor(x, y)
+			lcd.Print([]byte{' '})
+			x, y = rand.Intn(lcdWidth), rand.Intn(lcdHeight)
+			lcd.SetCursor(x, y)
+			lcd.Print([]byte{'.'})
+		}
+		lcdMu.Unlock()
+	}
+}
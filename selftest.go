@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// one power-on self-test check
+type selfCheck struct {
+	name string
+	run  func() error
+}
+
+// Run each check, printing PASS or FAIL with the reason to serial, and show
+// how many passed on the LCD. Failures are only reported; boot goes on so
+// the rest of the hardware can still be used.
+func selfTest(checks []selfCheck, display func(msg string)) (failed int) {
+	for _, c := range checks {
+		if err := c.run(); err != nil {
+			logError("self-test FAIL " + c.name + ": " + err.Error())
+			failed++
+			continue
+		}
+		logInfo("self-test PASS " + c.name)
+	}
+	passed := strconv.Itoa(len(checks)-failed) + "/" + strconv.Itoa(len(checks))
+	display("self-test " + passed + " ok")
+	// leave the summary up long enough to read
+	pause(2 * time.Second)
+	return failed
+}
+
+// the checks for the display at lcdAddr, the sensor and the NINA
+func bootChecks(lcdAddr uint8) []selfCheck {
+	return []selfCheck{
+		{"display", func() error {
+			if !i2cPresent(i2cBus, lcdAddr) {
+				return errors.New("no ACK at 0x" + strconv.FormatUint(uint64(lcdAddr), 16))
+			}
+			return nil
+		}},
+		{"sensor", func() error {
+			_, err := sensor.Read()
+			return err
+		}},
+		{"NINA", func() error {
+			fw, err := adaptor.GetFwVersion()
+			if err == nil {
+				logInfo("NINA firmware " + fw)
+			}
+			return err
+		}},
+	}
+}
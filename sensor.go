@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"time"
+	"tinygo.org/x/drivers/bme280"
+	"tinygo.org/x/drivers/dht"
+)
+
+var (
+	// the sensor chosen by setupSensor
+	sensor Sensor
+
+	// moving averages of the readings over config.SmoothWindow samples
+	smoothTemp = newSmoother(config.SmoothWindow)
+	smoothHum  = newSmoother(config.SmoothWindow)
+	smoothPres = newSmoother(config.SmoothWindow)
+)
+
+// Reading is one set of values published together; zero pres or bat means
+// the board has no barometer or battery divider
+type Reading struct {
+	temp, hum, pres, bat float32
+}
+
+// Sensor is a source of readings, so loop() works the same whichever one
+// is fitted. The DS18B20 probes aren't one: their conversion takes too long
+// to wait for, so pollProbes runs them alongside.
+type Sensor interface {
+	// temperature (C), humidity (%) and, if the sensor has a barometer,
+	// pressure (hPa)
+	Read() (Reading, error)
+}
+
+// set up the sensor selected by config.Sensor, or simulated readings with
+// config.Simulate. The BME280 shares the I2C bus with the LCD backpack, so
+// it must not sit at the LCD's address.
+func setupSensor(lcdAddr uint8) error {
+	if config.Simulate {
+		sensor = simSensor{}
+		return nil
+	}
+	switch config.Sensor {
+	case config.SensorDHT22:
+		sensor = dhtSensor{dev: dht.New(config.DHTPin, dht.DHT22)}
+	case config.SensorBME280:
+		if config.BME280Address == lcdAddr {
+			return errors.New("BME280 and LCD share I2C address 0x" + strconv.FormatUint(uint64(config.BME280Address), 16))
+		}
+		bme := bme280.New(i2cBus)
+		bme.Address = uint16(config.BME280Address)
+		lcdMu.Lock()
+		defer lcdMu.Unlock()
+		if !bme.Connected() {
+			return errors.New("no BME280 at 0x" + strconv.FormatUint(uint64(config.BME280Address), 16))
+		}
+		bme.Configure()
+		sensor = &bme280Sensor{dev: bme}
+	case config.SensorUART:
+		setupUARTSensor()
+		sensor = uartSensor{}
+	default:
+		return errors.New("unknown sensor type")
+	}
+	return nil
+}
+
+// Read the sensor and add the values to the moving averages, returning
+// the averages along with the battery voltage
+func sample() (Reading, error) {
+	r, err := sensor.Read()
+	if err != nil {
+		return Reading{}, err
+	}
+	smoothTemp.Add(r.temp)
+	smoothHum.Add(r.hum)
+	smoothPres.Add(r.pres)
+	return Reading{temp: smoothTemp.Mean(), hum: smoothHum.Mean(), pres: smoothPres.Mean(), bat: readBattery()}, nil
+}
+
+// dhtSensor is a DHT22 temperature/humidity sensor
+type dhtSensor struct {
+	dev dht.Device
+}
+
+// read temperature and humidity, retrying once because checksum failures
+// are common
+func (s dhtSensor) Read() (r Reading, err error) {
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			// the DHT22 needs 2 seconds between reads
+			time.Sleep(2 * time.Second)
+		}
+		t, h, e := s.dev.Measurements()
+		if e == nil {
+			return Reading{temp: float32(t) / 10, hum: float32(h) / 10}, nil
+		}
+		logError("DHT read failed: " + e.Error())
+		err = e
+	}
+	return Reading{}, err
+}
+
+// bme280Sensor is a BME280 temperature/humidity/pressure sensor on the
+// LCD's I2C bus
+type bme280Sensor struct {
+	dev bme280.Device
+}
+
+// read temperature, humidity and pressure. lcdMu is held so the reads
+// don't interleave with LCD writes on the shared bus.
+func (s *bme280Sensor) Read() (Reading, error) {
+	lcdMu.Lock()
+	defer lcdMu.Unlock()
+
+	t, err := s.dev.ReadTemperature()
+	if err != nil {
+		logError("BME280 read failed: " + err.Error())
+		return Reading{}, err
+	}
+	h, err := s.dev.ReadHumidity()
+	if err != nil {
+		logError("BME280 read failed: " + err.Error())
+		return Reading{}, err
+	}
+	p, err := s.dev.ReadPressure()
+	if err != nil {
+		logError("BME280 read failed: " + err.Error())
+		return Reading{}, err
+	}
+	// milli degrees, hundredths of a percent and milli pascals
+	return Reading{temp: float32(t) / 1000, hum: float32(h) / 100, pres: float32(p) / 100000}, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeSensor hands out readings in turn, failing with err once they run out
+type fakeSensor struct {
+	readings []Reading
+	err      error
+}
+
+func (s *fakeSensor) Read() (Reading, error) {
+	if len(s.readings) == 0 {
+		return Reading{}, s.err
+	}
+	r := s.readings[0]
+	s.readings = s.readings[1:]
+	return r, nil
+}
+
+func TestFakeSensorPublishes(t *testing.T) {
+	defer func(s Sensor, st, sh, sp *Smoother) {
+		sensor, smoothTemp, smoothHum, smoothPres = s, st, sh, sp
+	}(sensor, smoothTemp, smoothHum, smoothPres)
+	smoothTemp, smoothHum, smoothPres = newSmoother(2), newSmoother(2), newSmoother(2)
+	sensor = &fakeSensor{
+		readings: []Reading{
+			{temp: 20, hum: 40, pres: 1000},
+			{temp: 22, hum: 50, pres: 1010},
+		},
+		err: errors.New("sensor unplugged"),
+	}
+	cl := &fakeClient{}
+	cl.connected = true
+	p := newTestPublisher(cl)
+
+	want := []string{
+		`{"t":20,"tu":"C","h":40,"p":1000.0,"pu":"hPa","seq":0,"ms":`,
+		`{"t":21,"tu":"C","h":45,"p":1005.0,"pu":"hPa","seq":1,"ms":`, // smoothed
+	}
+	for i := range want {
+		r, err := sample()
+		if err != nil {
+			t.Fatalf("sample %d: %v", i+1, err)
+		}
+		if got := p.SendString("tinygo/test/tx", encodePayload(r)); got != sendSent {
+			t.Fatalf("sample %d: Send = %v, want sendSent", i+1, got)
+		}
+	}
+	if len(cl.sent) != len(want) {
+		t.Fatalf("sent %d messages, want %d", len(cl.sent), len(want))
+	}
+	for i, m := range cl.sent {
+		got := string(m.payload)
+		if m.topic != "tinygo/test/tx" || len(got) < len(want[i]) || got[:len(want[i])] != want[i] {
+			t.Errorf("message %d = %s on %s, want %s... on tinygo/test/tx", i, got, m.topic, want[i])
+		}
+	}
+
+	// a failed read publishes nothing and leaves the averages alone
+	if _, err := sample(); err == nil {
+		t.Fatal("sample after the readings ran out succeeded")
+	}
+	if got := smoothTemp.Mean(); got != 21 {
+		t.Errorf("temperature average after a failed read = %v, want 21", got)
+	}
+}
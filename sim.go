@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+	"tinygo.org/x/drivers/net/mqtt"
+)
+
+// Simulation mode (config.Simulate) runs the firmware with no NINA, LCD or
+// sensor attached: the display is printed to serial, the MQTT client only
+// logs what it would send and the readings are made up. Everything in
+// between runs as usual, so changes can be tried on a board with nothing
+// wired to it.
+//
+// Running the firmware on the host is not supported, and won't be by this
+// mode. machine is a TinyGo package that plain go can't provide, and it is
+// imported by config (every pin setting), by most files here and by the
+// wifinina, dht and ssd1306 drivers. Hiding all of that behind a build tag
+// would need a host twin of main and of every file that touches a pin, and
+// two copies of the connect loop to keep in step.
+
+// simClient is an mqtt.Client that is always connected and logs what it
+// is asked to publish.
+type simClient struct {
+	connected bool
+}
+
+// simToken is a token for an operation that succeeded at once
+type simToken struct{}
+
+func (simToken) Wait() bool                     { return true }
+func (simToken) WaitTimeout(time.Duration) bool { return true }
+func (simToken) Error() error                   { return nil }
+
+func (c *simClient) IsConnected() bool      { return c.connected }
+func (c *simClient) IsConnectionOpen() bool { return c.connected }
+
+func (c *simClient) Connect() mqtt.Token {
+	logInfo("sim: connected to " + server)
+	c.connected = true
+	return simToken{}
+}
+
+func (c *simClient) Disconnect(quiesce uint) {
+	logInfo("sim: disconnected")
+	c.connected = false
+}
+
+func (c *simClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	logInfo(fmt.Sprintf("sim: publish %s (qos %d, retained %t): %s", topic, qos, retained, payload))
+	return simToken{}
+}
+
+func (c *simClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	logInfo("sim: subscribe " + topic)
+	return simToken{}
+}
+
+func (c *simClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	return simToken{}
+}
+
+func (c *simClient) Unsubscribe(topics ...string) mqtt.Token { return simToken{} }
+
+func (c *simClient) AddRoute(topic string, callback mqtt.MessageHandler) {}
+
+func (c *simClient) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+// simSensor stands in for the sensor in simulation mode
+type simSensor struct{}
+
+// plausible indoor readings that drift a little between calls
+func (simSensor) Read() (Reading, error) {
+	return Reading{temp: 22 + rand.Float32()*2, hum: 45 + rand.Float32()*10}, nil
+}
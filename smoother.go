@@ -0,0 +1,39 @@
+package main
+
+// Smoother is a moving average over the last len(buf) values, used to take
+// the jitter out of sensor readings before they are published.
+type Smoother struct {
+	buf  []float32
+	next int // index the next value is written to
+	n    int
+}
+
+// new Smoother averaging over window values, at least one
+func newSmoother(window int) *Smoother {
+	if window < 1 {
+		window = 1
+	}
+	return &Smoother{buf: make([]float32, window)}
+}
+
+// Add v, replacing the oldest value once the window is full
+func (s *Smoother) Add(v float32) {
+	s.buf[s.next] = v
+	s.next = (s.next + 1) % len(s.buf)
+	if s.n < len(s.buf) {
+		s.n++
+	}
+}
+
+// Mean of the values in the window, 0 before the first Add
+func (s *Smoother) Mean() float32 {
+	if s.n == 0 {
+		return 0
+	}
+	// summed afresh each time so float rounding can't accumulate
+	var sum float32
+	for _, v := range s.buf[:s.n] {
+		sum += v
+	}
+	return sum / float32(s.n)
+}
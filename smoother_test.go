@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestSmoother(t *testing.T) {
+	s := newSmoother(3)
+	if got := s.Mean(); got != 0 {
+		t.Errorf("empty: Mean() = %v, want 0", got)
+	}
+	tests := []struct {
+		add  float32
+		want float32
+	}{
+		{3, 3}, // partial window: only the values so far count
+		{6, 4.5},
+		{9, 6},  // full
+		{12, 9}, // wrapped: 3 dropped
+		{15, 12},
+		{18, 15}, // wrapped all the way round
+	}
+	for i, tt := range tests {
+		s.Add(tt.add)
+		if got := s.Mean(); got != tt.want {
+			t.Errorf("after %d adds: Mean() = %v, want %v", i+1, got, tt.want)
+		}
+	}
+}
+
+func TestSmootherWindowAtLeastOne(t *testing.T) {
+	s := newSmoother(0)
+	s.Add(1)
+	s.Add(5)
+	if got := s.Mean(); got != 5 {
+		t.Errorf("Mean() = %v, want 5", got)
+	}
+}
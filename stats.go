@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"time"
+)
+
+// topic the counters go to, the tx topic plus config.StatsSuffix
+var topicStats string
+
+// stats counts what happened on the MQTT link since boot, so a flaky link
+// shows up as failures and reconnects climbing over the days.
+// received is bumped by the mqtt client's goroutine, the rest by loop();
+// TinyGo only switches goroutines when one blocks, so plain ints are safe.
+type stats struct {
+	published  int
+	failed     int
+	received   int
+	reconnects int
+	badFrames  int
+}
+
+var counters stats
+
+// the counters as JSON like
+// {"pub":12,"fail":1,"rx":3,"reconn":0,"bad":0,"queue":0,"drop":2}, with
+// the outbox depth and drops of p
+func (s *stats) json(p *Publisher) string {
+	return `{"pub":` + strconv.Itoa(s.published) +
+		`,"fail":` + strconv.Itoa(s.failed) +
+		`,"rx":` + strconv.Itoa(s.received) +
+		`,"reconn":` + strconv.Itoa(s.reconnects) +
+		`,"bad":` + strconv.Itoa(s.badFrames) +
+		`,"queue":` + strconv.Itoa(p.Depth()) +
+		`,"drop":` + strconv.Itoa(p.Dropped()) + `}`
+}
+
+// the counters short enough for one LCD row, like "P12 F1 R3 C0"
+func (s *stats) text() string {
+	return "P" + strconv.Itoa(s.published) +
+		" F" + strconv.Itoa(s.failed) +
+		" R" + strconv.Itoa(s.received) +
+		" C" + strconv.Itoa(s.reconnects)
+}
+
+// count the outcome of a publish
+func (s *stats) publish(err error) {
+	if err != nil {
+		s.failed++
+		return
+	}
+	s.published++
+}
+
+// publish the counters and the state of pub to topicStats
+func publishStats() {
+	pub.SendWith(topicStats, []byte(counters.json(pub)), 0, config.EventRetain)
+}
+
+// whether the counters are due, given when they last went out
+func statsDue(last time.Time) bool {
+	return config.StatsInterval > 0 && time.Since(last) >= config.StatsInterval
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatsPublish(t *testing.T) {
+	var s stats
+	for _, err := range []error{nil, nil, errors.New("timeout"), nil, errors.New("closed")} {
+		s.publish(err)
+	}
+	if s.published != 3 || s.failed != 2 {
+		t.Errorf("published, failed = %d, %d, want 3, 2", s.published, s.failed)
+	}
+}
+
+func TestStatsFormats(t *testing.T) {
+	p := newPublisher(&simClient{}, 0, false, newLimiter(0, 1, time.Now), nil)
+	p.Send("t", []byte("queued")) // not connected, so it waits in the outbox
+
+	tests := []struct {
+		s    stats
+		json string
+		text string
+	}{
+		{
+			stats{},
+			`{"pub":0,"fail":0,"rx":0,"reconn":0,"bad":0,"queue":1,"drop":0}`,
+			"P0 F0 R0 C0",
+		},
+		{
+			stats{published: 12, failed: 1, received: 3, reconnects: 2, badFrames: 5},
+			`{"pub":12,"fail":1,"rx":3,"reconn":2,"bad":5,"queue":1,"drop":0}`,
+			"P12 F1 R3 C2",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.s.json(p); got != tt.json {
+			t.Errorf("json() = %s, want %s", got, tt.json)
+		}
+		if got := tt.s.text(); got != tt.text {
+			t.Errorf("text() = %q, want %q", got, tt.text)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"strings"
+)
+
+// device ID substituted for {id} in config.TopicPrefix
+var topicID string
+
+// topic for suffix under config.TopicPrefix with {id} replaced, so
+// "tinygo/{id}" and "tx" give "tinygo/0123456789AB/tx"
+func buildTopic(suffix string) string {
+	return strings.ReplaceAll(config.TopicPrefix, "{id}", topicID) + "/" + suffix
+}
+
+// Work out every topic from config.TopicPrefix. Needs the NINA for the MAC
+// address, so it runs once the adaptor is up.
+func setupTopics() {
+	topicID = deviceID()
+	if topicID == "" {
+		topicID = "unknown"
+	}
+
+	topicTx = buildTopic("tx")
+	topicStatus = topicTx + config.StatusSuffix
+	topicInfo = topicTx + config.InfoSuffix
+	topicAlert = topicTx + config.AlertSuffix
+	topicUptime = topicTx + config.UptimeSuffix
+	topicStats = topicTx + config.StatsSuffix
+	topicNet = topicTx + config.NetSuffix
+
+	topicsRx = make([]string, len(config.RxTopics))
+	for i, suffix := range config.RxTopics {
+		topicsRx[i] = buildTopic(suffix)
+	}
+	topicsBinary = make([]string, len(config.BinaryRxTopics))
+	for i, suffix := range config.BinaryRxTopics {
+		topicsBinary[i] = buildTopic(suffix)
+	}
+	topicsRx = append(topicsRx, topicsBinary...)
+	if config.ControlTopic != "" {
+		topicControl = buildTopic(config.ControlTopic)
+		topicsRx = append(topicsRx, topicControl)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"testing"
+)
+
+func TestBuildTopic(t *testing.T) {
+	defer func(prefix, id string) { config.TopicPrefix, topicID = prefix, id }(config.TopicPrefix, topicID)
+	topicID = "0123456789AB"
+
+	tests := []struct {
+		prefix, suffix string
+		want           string
+	}{
+		{"tinygo/{id}", "tx", "tinygo/0123456789AB/tx"},
+		{"{id}", "rx/backlight", "0123456789AB/rx/backlight"},
+		{"home/{id}/{id}", "tx", "home/0123456789AB/0123456789AB/tx"},
+		{"tinygo", "rx", "tinygo/rx"}, // no {id}
+		{"{ID}/x", "rx", "{ID}/x/rx"}, // the placeholder is lower case
+	}
+	for _, tt := range tests {
+		config.TopicPrefix = tt.prefix
+		if got := buildTopic(tt.suffix); got != tt.want {
+			t.Errorf("buildTopic(%q) with prefix %q = %q, want %q", tt.suffix, tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/amanoese/belltomo/config"
+	"machine"
+)
+
+// Frames sent by a sensor board on UART1 (D0/D1) for config.SensorUART:
+//
+//	0xA5, len, payload[len], crc8
+//
+// crc8 is CRC-8 (polynomial 0x07, initial 0) over len and the payload. A
+// reading payload is three little-endian 16-bit values: temperature in
+// 0.1C (signed), humidity in 0.1% and pressure in 0.1hPa, 0 for none.
+const (
+	frameStart     = 0xA5
+	maxFrameLen    = 16
+	readingLen     = 6
+	crc8Polynomial = 0x07
+)
+
+// frame parser states
+const (
+	frameSync = iota
+	frameLen
+	framePayload
+	frameCRC
+)
+
+// add b to a running CRC-8
+func crc8(crc, b byte) byte {
+	crc ^= b
+	for i := 0; i < 8; i++ {
+		if crc&0x80 != 0 {
+			crc = crc<<1 ^ crc8Polynomial
+		} else {
+			crc <<= 1
+		}
+	}
+	return crc
+}
+
+// frameParser picks frames out of a byte stream one byte at a time,
+// resyncing on the next start byte after anything malformed.
+type frameParser struct {
+	state int
+	want  int
+	n     int
+	crc   byte
+	buf   [maxFrameLen]byte
+
+	// frames dropped for a bad length or CRC
+	bad int
+}
+
+// Feed c to the parser. ok is true when c completed a frame with a good
+// CRC; payload is only valid until the next call.
+func (p *frameParser) feed(c byte) (payload []byte, ok bool) {
+	switch p.state {
+	case frameSync:
+		if c == frameStart {
+			p.state = frameLen
+		}
+	case frameLen:
+		if c == 0 || c > maxFrameLen {
+			p.bad++
+			p.state = frameSync
+			return nil, false
+		}
+		p.want = int(c)
+		p.n = 0
+		p.crc = crc8(0, c)
+		p.state = framePayload
+	case framePayload:
+		p.buf[p.n] = c
+		p.n++
+		p.crc = crc8(p.crc, c)
+		if p.n == p.want {
+			p.state = frameCRC
+		}
+	case frameCRC:
+		p.state = frameSync
+		if c != p.crc {
+			p.bad++
+			return nil, false
+		}
+		return p.buf[:p.n], true
+	}
+	return nil, false
+}
+
+var (
+	// frames from the UART sensor board
+	uartFrames frameParser
+
+	errNoFrame = errors.New("no sensor frame")
+)
+
+// listen for frames on UART1 at config.SensorBaud
+func setupUARTSensor() {
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: config.SensorBaud})
+}
+
+// uartSensor is another board sending readings in frames on UART1
+type uartSensor struct{}
+
+// Read temperature (C), humidity (%) and pressure (hPa) from the newest
+// good frame received since the last call. Bad frames are dropped and
+// counted, so garbage on the line never gets published.
+func (uartSensor) Read() (r Reading, err error) {
+	err = errNoFrame
+	bad := uartFrames.bad
+	for machine.UART1.Buffered() > 0 {
+		c, e := machine.UART1.ReadByte()
+		if e != nil {
+			break
+		}
+		payload, ok := uartFrames.feed(c)
+		if !ok {
+			continue
+		}
+		if len(payload) != readingLen {
+			uartFrames.bad++
+			continue
+		}
+		r.temp = float32(int16(binary.LittleEndian.Uint16(payload[0:]))) / 10
+		r.hum = float32(binary.LittleEndian.Uint16(payload[2:])) / 10
+		r.pres = float32(binary.LittleEndian.Uint16(payload[4:])) / 10
+		err = nil
+	}
+	if n := uartFrames.bad - bad; n > 0 {
+		counters.badFrames += n
+		logError("dropped bad sensor frames")
+	}
+	return r, err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// a frame carrying payload, with its CRC
+func makeFrame(payload ...byte) []byte {
+	crc := crc8(0, byte(len(payload)))
+	for _, b := range payload {
+		crc = crc8(crc, b)
+	}
+	f := append([]byte{frameStart, byte(len(payload))}, payload...)
+	return append(f, crc)
+}
+
+// feed all of in, returning the frames it completed
+func feedAll(p *frameParser, in []byte) [][]byte {
+	var frames [][]byte
+	for _, c := range in {
+		if payload, ok := p.feed(c); ok {
+			frames = append(frames, append([]byte(nil), payload...))
+		}
+	}
+	return frames
+}
+
+func TestCRC8(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want byte
+	}{
+		{[]byte{}, 0x00},
+		{[]byte{0x00}, 0x00},
+		{[]byte{0x01}, 0x07},
+		{[]byte("123456789"), 0xF4}, // the CRC-8/SMBUS check value
+	}
+	for _, tt := range tests {
+		var crc byte
+		for _, b := range tt.in {
+			crc = crc8(crc, b)
+		}
+		if crc != tt.want {
+			t.Errorf("crc8(%q) = %#02x, want %#02x", tt.in, crc, tt.want)
+		}
+	}
+}
+
+func TestFrameParserGoodFrame(t *testing.T) {
+	var p frameParser
+	frames := feedAll(&p, makeFrame(1, 2, 3, 4, 5, 6))
+	if len(frames) != 1 || !bytes.Equal(frames[0], []byte{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("frames = %v, want one of 1..6", frames)
+	}
+	if p.bad != 0 {
+		t.Errorf("bad = %d, want 0", p.bad)
+	}
+}
+
+func TestFrameParserRejectsBadCRC(t *testing.T) {
+	var p frameParser
+	f := makeFrame(1, 2, 3)
+	f[len(f)-1] ^= 0xFF
+	if frames := feedAll(&p, f); len(frames) != 0 {
+		t.Errorf("frame with a bad CRC accepted: %v", frames)
+	}
+	if p.bad != 1 {
+		t.Errorf("bad = %d, want 1", p.bad)
+	}
+
+	// and the next good frame still comes through
+	if frames := feedAll(&p, makeFrame(7)); len(frames) != 1 || frames[0][0] != 7 {
+		t.Errorf("frames after a bad CRC = %v, want [[7]]", frames)
+	}
+}
+
+func TestFrameParserResyncsAfterGarbage(t *testing.T) {
+	var in []byte
+	in = append(in, 0x00, 0xFF, 0x13, 0x37)               // line noise
+	in = append(in, frameStart, 0)                        // zero length
+	in = append(in, frameStart, maxFrameLen+1)            // too long
+	in = append(in, makeFrame(1, 2)[:3]...)               // cut short...
+	in = append(in, makeFrame(9, 8, 7)...)                // ...so this is read as its tail
+	in = append(in, 0x42)                                 // more noise
+	in = append(in, makeFrame(4, 5, 6)...)                // good
+	in = append(in, makeFrame(0x10, 0x20, 0x30, 0x40)...) // good
+
+	var p frameParser
+	frames := feedAll(&p, in)
+	want := [][]byte{{4, 5, 6}, {0x10, 0x20, 0x30, 0x40}}
+	if len(frames) != len(want) {
+		t.Fatalf("frames = %v, want %v", frames, want)
+	}
+	for i := range want {
+		if !bytes.Equal(frames[i], want[i]) {
+			t.Errorf("frame %d = %v, want %v", i, frames[i], want[i])
+		}
+	}
+	if p.bad < 3 {
+		t.Errorf("bad = %d, want at least 3", p.bad)
+	}
+}
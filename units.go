@@ -0,0 +1,32 @@
+package main
+
+import "github.com/amanoese/belltomo/config"
+
+// Readings stay in C and hPa throughout; these convert them to the units
+// in config just before they are shown or published.
+
+func celsiusToFahrenheit(c float32) float32 {
+	return c*9/5 + 32
+}
+
+// inches of mercury at 0C
+func hPaToInHg(p float32) float32 {
+	return p * 0.0295300
+}
+
+// temperature c in config.TempUnit, with the unit's symbol
+func tempIn(c float32) (float32, string) {
+	if config.TempUnit == config.Fahrenheit {
+		return celsiusToFahrenheit(c), "F"
+	}
+	return c, "C"
+}
+
+// pressure p in config.PressureUnit, with the unit's symbol and the
+// decimals worth showing
+func presIn(p float32) (v float32, unit string, prec int) {
+	if config.PressureUnit == config.InHg {
+		return hPaToInHg(p), "inHg", 2
+	}
+	return p, "hPa", 1
+}
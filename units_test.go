@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"math"
+	"testing"
+)
+
+// report whether a and b agree to within tol
+func near(a, b, tol float32) bool {
+	return math.Abs(float64(a-b)) <= float64(tol)
+}
+
+func TestCelsiusToFahrenheit(t *testing.T) {
+	tests := []struct{ c, f float32 }{
+		{0, 32},
+		{100, 212},
+		{-40, -40},
+		{37, 98.6},
+		{22.5, 72.5},
+	}
+	for _, tt := range tests {
+		if got := celsiusToFahrenheit(tt.c); !near(got, tt.f, 0.001) {
+			t.Errorf("celsiusToFahrenheit(%v) = %v, want %v", tt.c, got, tt.f)
+		}
+	}
+}
+
+func TestHPaToInHg(t *testing.T) {
+	tests := []struct{ hPa, inHg float32 }{
+		{0, 0},
+		{1013.25, 29.92}, // standard atmosphere
+		{1000, 29.53},
+		{950, 28.05},
+	}
+	for _, tt := range tests {
+		if got := hPaToInHg(tt.hPa); !near(got, tt.inHg, 0.005) {
+			t.Errorf("hPaToInHg(%v) = %v, want %v", tt.hPa, got, tt.inHg)
+		}
+	}
+}
+
+func TestTempIn(t *testing.T) {
+	defer func(u int) { config.TempUnit = u }(config.TempUnit)
+	tests := []struct {
+		unit int
+		c    float32
+		want float32
+		sym  string
+	}{
+		{config.Celsius, 21.5, 21.5, "C"},
+		{config.Fahrenheit, 21.5, 70.7, "F"},
+		{config.Fahrenheit, -40, -40, "F"},
+	}
+	for _, tt := range tests {
+		config.TempUnit = tt.unit
+		got, sym := tempIn(tt.c)
+		if !near(got, tt.want, 0.001) || sym != tt.sym {
+			t.Errorf("tempIn(%v) in %v = %v %s, want %v %s", tt.c, tt.unit, got, sym, tt.want, tt.sym)
+		}
+	}
+}
+
+func TestPresIn(t *testing.T) {
+	defer func(u int) { config.PressureUnit = u }(config.PressureUnit)
+	tests := []struct {
+		unit int
+		p    float32
+		want float32
+		sym  string
+		prec int
+	}{
+		{config.HPa, 1013.25, 1013.25, "hPa", 1},
+		{config.InHg, 1013.25, 29.92, "inHg", 2},
+	}
+	for _, tt := range tests {
+		config.PressureUnit = tt.unit
+		got, sym, prec := presIn(tt.p)
+		if !near(got, tt.want, 0.005) || sym != tt.sym || prec != tt.prec {
+			t.Errorf("presIn(%v) in %v = %v %s %d, want %v %s %d", tt.p, tt.unit, got, sym, prec, tt.want, tt.sym, tt.prec)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/amanoese/belltomo/config"
+	"machine"
+	"time"
+)
+
+// The SAMD21 watchdog tops out at about 16 seconds, so long waits are
+// sliced up with pause() and the watchdog fed between slices.
+const watchdogTimeout = 16000 // ms
+
+// start the hardware watchdog if enabled in config
+func startWatchdog() {
+	if !config.Watchdog {
+		return
+	}
+	machine.Watchdog.Configure(machine.WatchdogConfig{TimeoutMillis: watchdogTimeout})
+	if err := machine.Watchdog.Start(); err != nil {
+		logError("watchdog: " + err.Error())
+	}
+}
+
+// tell the watchdog we are still alive
+func feedWatchdog() {
+	if config.Watchdog {
+		machine.Watchdog.Update()
+	}
+}
+
+// sleep for d, feeding the watchdog at least once a second
+func pause(d time.Duration) {
+	for d > 0 {
+		step := d
+		if step > time.Second {
+			step = time.Second
+		}
+		time.Sleep(step)
+		feedWatchdog()
+		d -= step
+	}
+}
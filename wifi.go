@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"github.com/amanoese/belltomo/config"
+	"strconv"
+	"strings"
+	"time"
+	"tinygo.org/x/drivers/wifinina"
+)
+
+// access point info, tried in order
+var accessPoints = append([]config.AccessPoint{{SSID: config.SSID, PASS: config.PASS}}, config.FallbackAPs...)
+
+// how long to wait on one access point before trying the next
+const apTimeout = 15 * time.Second
+
+// connect to access point, cycling through accessPoints until one accepts
+// or config.WiFiTimeout passes
+func connectToAP(display func(msg string)) error {
+	time.Sleep(2 * time.Second)
+	deadline := time.Now().Add(config.WiFiTimeout)
+	b := NewBackoff(1*time.Second, 10*time.Second)
+	for i := 0; !joinAP(accessPoints[i%len(accessPoints)], display); i++ {
+		if time.Now().After(deadline) {
+			display("WiFi timeout")
+			return errors.New("WiFi timeout joining an access point")
+		}
+		pause(b.Next())
+	}
+	logInfo("Connected.")
+	time.Sleep(2 * time.Second)
+	b.Reset()
+	ip, subnet, gateway, err := adaptor.GetIP()
+	for ; err != nil; ip, subnet, gateway, err = adaptor.GetIP() {
+		ninaCheck(err, display)
+		if time.Now().After(deadline) {
+			display("WiFi timeout")
+			return errors.New("WiFi timeout getting an IP address")
+		}
+		pause(b.Next())
+	}
+	logInfo("IP " + ip.String() + " mask " + subnet.String() + " gw " + gateway.String())
+	display(ip.String())
+	if config.ShowGateway {
+		display("gw " + gateway.String())
+	}
+	if config.DNS != "" {
+		if err := checkDNS(); err != nil {
+			display("DNS failed")
+			return err
+		}
+	}
+	return nil
+}
+
+// host part of a tcp://host:port or ssl://host:port broker URL
+func brokerHost(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	if i := strings.LastIndexByte(url, ':'); i >= 0 {
+		url = url[:i]
+	}
+	return url
+}
+
+// Resolve the broker through the configured DNS server, so a wrong
+// config.DNS reports itself instead of as a failing MQTT connect.
+func checkDNS() error {
+	host := brokerHost(server)
+	if _, err := parseIPv4(host); err == nil {
+		// nothing to resolve
+		return nil
+	}
+	ip, err := adaptor.GetHostByName(host)
+	if err != nil {
+		return errors.New("DNS " + config.DNS + " can't resolve " + host + ": " + err.Error())
+	}
+	logInfo(host + " is " + ip.String())
+	return nil
+}
+
+// try to join ap, giving up after apTimeout
+func joinAP(ap config.AccessPoint, display func(msg string)) bool {
+	logInfo("Connecting to " + ap.SSID)
+	display(ap.SSID)
+	applyStaticIP()
+	adaptor.SetPassphrase(ap.SSID, ap.PASS)
+	deadline := time.Now().Add(apTimeout)
+	for {
+		st, err := adaptor.GetConnectionStatus()
+		ninaCheck(err, display)
+		if err == nil && st == wifinina.StatusConnected {
+			return true
+		}
+		if time.Now().After(deadline) {
+			logError("Giving up on " + ap.SSID)
+			return false
+		}
+		logDebug("Connection status: " + st.String())
+		pause(1 * time.Second)
+	}
+}
+
+// current WiFi signal strength like "-67dBm", or "--" if unknown
+func rssiText() string {
+	if config.Simulate {
+		return "--"
+	}
+	rssi, err := adaptor.GetCurrentRSSI()
+	if err != nil || rssi == 0 {
+		return "--"
+	}
+	return strconv.Itoa(int(rssi)) + "dBm"
+}
+
+// the NINA MAC address as 12 upper-case hex digits, or "" if it can't be read
+func deviceID() string {
+	if config.Simulate {
+		return ""
+	}
+	mac, err := adaptor.GetMACAddress()
+	if err != nil || mac == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.ReplaceAll(mac.String(), ":", ""))
+}
+
+// parse a dotted IPv4 address into the big-endian form the NINA expects
+func parseIPv4(s string) (uint32, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return 0, errors.New("bad IPv4 address: " + s)
+	}
+	var ip uint32
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 255 {
+			return 0, errors.New("bad IPv4 address: " + s)
+		}
+		ip = ip<<8 | uint32(n)
+	}
+	return ip, nil
+}
+
+// hand config.StaticIP, Gateway, Netmask and DNS to the NINA before it
+// joins, keeping DHCP when StaticIP is empty. v0.17 of the wifinina driver
+// answers SetIP with ErrNotImplemented; the address then still comes from
+// DHCP but the DNS server is applied.
+func applyStaticIP() {
+	if config.StaticIP == "" {
+		return
+	}
+	ip, err := parseIPv4(config.StaticIP)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	gw, err := parseIPv4(config.Gateway)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	mask, err := parseIPv4(config.Netmask)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	if err := adaptor.SetIP(3, ip, gw, mask); err != nil {
+		logError("static IP: " + err.Error() + ", using DHCP")
+	}
+
+	if config.DNS != "" {
+		dns, err := parseIPv4(config.DNS)
+		if err != nil {
+			logError(err.Error())
+			return
+		}
+		if err := adaptor.SetDNS(1, dns, 0); err != nil {
+			logError("DNS: " + err.Error())
+		}
+	}
+}
+
+// most access points scanNetworks shows on the LCD; the rest only go to
+// the log, so a crowded area doesn't hold up the boot
+const maxScanShown = 5
+
+// print the access points in range with their signal strength, showing
+// the first maxScanShown on the LCD for a second each. Purely diagnostic.
+func scanNetworks(display func(msg string)) {
+	display("scanning WiFi...")
+	if _, err := adaptor.StartScanNetworks(); err != nil {
+		logError("scan: " + err.Error())
+		return
+	}
+
+	// like the Arduino library, poll until the scan has found something
+	var n uint8
+	for i := 0; i < 10 && n == 0; i++ {
+		pause(2 * time.Second)
+		var err error
+		if n, err = adaptor.ScanNetworks(); err != nil {
+			logError("scan: " + err.Error())
+			return
+		}
+	}
+
+	logInfo("Found " + strconv.Itoa(int(n)) + " networks")
+	for i := 0; i < int(n); i++ {
+		ssid := adaptor.GetNetworkSSID(i)
+		rssi, _ := adaptor.GetNetworkRSSI(i)
+		enc, _ := adaptor.GetNetworkEncrType(i)
+		logInfo("  " + ssid + " " + strconv.Itoa(int(rssi)) + "dBm " + enc.String())
+		if i < maxScanShown {
+			display(ssid + " " + strconv.Itoa(int(rssi)))
+			pause(1 * time.Second)
+		}
+		feedWatchdog()
+	}
+}